@@ -0,0 +1,53 @@
+package fillinform
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrTooLarge is returned when a document, or the part of it a Writer has to
+// hold back, exceeds the MaxSize option.
+var ErrTooLarge = errors.New("fillinform: document exceeds MaxSize")
+
+// ParseError reports malformed html, such as a form without </form>.
+// Line and Column are 1-based, Column counts bytes.
+type ParseError struct {
+	Offset int
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("fillinform: line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// newParseError returns a ParseError for the byte at b[off].
+func newParseError(b []byte, off int, msg string) *ParseError {
+	line := bytes.Count(b[:off], []byte{'\n'}) + 1
+	col := off - bytes.LastIndexByte(b[:off], '\n')
+	return &ParseError{Offset: off, Line: line, Column: col, Msg: msg}
+}
+
+// OptionError reports an option that cannot be applied.
+type OptionError struct {
+	Key string
+	Msg string
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("fillinform: option %s: %s", e.Key, e.Msg)
+}
+
+// ValueError reports a value that is not valid for the type of its input,
+// with the InvalidReport policy.
+type ValueError struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("fillinform: invalid value %q for %s input %s", e.Value, e.Type, e.Name)
+}
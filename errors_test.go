@@ -0,0 +1,101 @@
+package fillinform
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var formDataErr = map[string][]string{
+	"title": []string{"hogeTitle"},
+}
+
+func TestParseError(t *testing.T) {
+	src := "<p>\n  <form id=\"a\"><input name=\"title\">\n</form>\n<form id=\"b\">\n  <input name=\"title\">\n"
+	htmlstr, err := Fill([]byte(src), formDataErr, nil)
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("parse error expected: %v", err)
+	}
+	if perr.Offset != 48 || perr.Line != 4 || perr.Column != 1 {
+		t.Errorf("parse error position: %+v", perr)
+	}
+	if string(htmlstr) != "<p>\n  <form id=\"a\"><input name=\"title\" value=\"hogeTitle\">\n</form>\n<form id=\"b\">\n  <input name=\"title\">\n" {
+		t.Errorf("parse error output: %s", htmlstr)
+	}
+
+	for _, src := range []string{
+		`<form id="a"><select name="s"><option>1</option></form>`,
+		`<form id="a"><textarea name="t"></form>`,
+		`<form id="a"><input name="t></form>`,
+	} {
+		if _, err := Fill([]byte(src), formDataErr, nil); err == nil {
+			t.Errorf("parse error expected: %s", src)
+		} else if perr := err.(*ParseError); perr.Offset != 13 || perr.Column != 14 {
+			t.Errorf("parse error position: %+v", perr)
+		}
+	}
+}
+
+func TestOptionError(t *testing.T) {
+	_, err := Fill([]byte(HTML), formDataErr, map[string]interface{}{"IgnoreFields": "title"})
+	if oerr, ok := err.(*OptionError); !ok || oerr.Key != "IgnoreFields" {
+		t.Errorf("option error expected: %v", err)
+	}
+	if _, err := NewFiller(WithOptions(map[string]interface{}{"MaxSize": -1})); err == nil {
+		t.Errorf("negative MaxSize should fail")
+	}
+
+	var buf bytes.Buffer
+	w := FillWriter(&buf, formDataErr, map[string]interface{}{"Target": 1})
+	if _, err := w.Write([]byte(HTML)); err == nil {
+		t.Errorf("writer option error expected")
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	options := map[string]interface{}{"MaxSize": 64}
+	if _, err := Fill([]byte(HTML), formDataErr, options); err != ErrTooLarge {
+		t.Errorf("size error expected: %v", err)
+	}
+
+	var buf bytes.Buffer
+	w := FillWriter(&buf, formDataErr, options)
+	for i := 0; i < 10; i++ {
+		if _, err := w.Write([]byte(`<p>small</p>`)); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+	w.Write([]byte(`<form id="a">`))
+	if _, err := w.Write(bytes.Repeat([]byte(`<p>held</p>`), 8)); err != ErrTooLarge {
+		t.Errorf("writer size error expected: %v", err)
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestWriterErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w := FillWriter(&buf, formDataErr, nil)
+	w.Write([]byte("<p>\n</p>\n<form id=\"a\">"))
+	w.Write([]byte("<input name=\"title\">\n"))
+	err := w.Close()
+	if perr, ok := err.(*ParseError); !ok || perr.Offset != 9 || perr.Line != 3 || perr.Column != 1 {
+		t.Errorf("writer parse error: %v", err)
+	}
+	if buf.String() != "<p>\n</p>\n<form id=\"a\"><input name=\"title\">\n" {
+		t.Errorf("writer pass through error: %s", buf.String())
+	}
+
+	w = FillWriter(failWriter{}, formDataErr, nil)
+	if _, err := w.Write([]byte(`<p></p>`)); err == nil || err.Error() != "disk full" {
+		t.Errorf("write error expected: %v", err)
+	}
+	if err := w.Close(); err == nil {
+		t.Errorf("write error should stick")
+	}
+}
@@ -2,16 +2,17 @@ package fillinform
 
 import (
 	"bytes"
-	"fmt"
-	"io"
 	"regexp"
+	"strings"
 )
 
 const (
 	_Form     = `form`
+	_Template = `template`
 	_Input    = `input`
 	_Select   = `select`
 	_Option   = `option`
+	_Optgroup = `optgroup`
 	_Textarea = `textarea`
 	_Checked  = `checked`
 	_Selected = `selected`
@@ -20,347 +21,512 @@ const (
 	_Type     = `type`
 	_Name     = `name`
 	_Value    = `value`
-
-	spaceRxp     = `\s`
-	attrNameRxp  = `[\w\-]+`
-	attrValueRxp = `(?:"[^"]*"|'[^']*'|[^'"/>\s]+|[\w\-]+)`
-	attrRxp      = `(?:` + spaceRxp + `+(?:` + attrNameRxp + `(?:=` + attrValueRxp + `)?))`
-
-	startFormRxp     = `(?:<` + _Form + attrRxp + `+` + spaceRxp + `*>)`
-	inputRxp         = `(?:<` + _Input + attrRxp + `+` + spaceRxp + `*/?>)`
-	startSelectRxp   = `(?:<` + _Select + attrRxp + `+` + spaceRxp + `*>)`
-	startOptionRxp   = `(?:<` + _Option + attrRxp + `*` + spaceRxp + `*>)`
-	startTextareaRxp = `(?:<` + _Textarea + attrRxp + `+` + spaceRxp + `*>)`
-
-	endFormRxp     = `(?:</` + _Form + `>)`
-	endSelectRxp   = `(?:</` + _Select + `>)`
-	endOptionRxp   = `(?:</` + _Option + `>)`
-	endTextareaRxp = `(?:</` + _Textarea + `>)`
-
-	checkedRxp  = `(?:` + _Checked + `(?:=(?:"` + _Checked + `"|'` + _Checked + `'|` + _Checked + `))?)`
-	selectedRxp = `(?:` + _Selected + `(?:=(?:"` + _Selected + `"|'` + _Selected + `'|` + _Selected + `))?)`
-	multipleRxp = `(?:` + _Multiple + `(?:=(?:"` + _Multiple + `"|'` + _Multiple + `'|` + _Multiple + `))?)`
+	_Action   = `action`
 )
 
 var (
-	checkboxBytes   = []byte(`checkbox`)
-	radioBytes      = []byte(`radio`)
-	textBytes       = []byte(`text`)
-	ampBytes        = []byte(`&amp;`)
-	ltBytes         = []byte(`&lt;`)
-	gtBytes         = []byte(`&gt;`)
-	quotBytes       = []byte(`&quot;`)
-	checkedBytes    = []byte(` checked="checked"$1>`)
-	selectedBytes   = []byte(` selected="selected">`)
-	blankBytes      = []byte(``)
-	doubleQuotBytes = []byte(`"`)
+	ampBytes      = []byte(`&amp;`)
+	ltBytes       = []byte(`&lt;`)
+	gtBytes       = []byte(`&gt;`)
+	quotBytes     = []byte(`&quot;`)
+	checkedBytes  = []byte(` checked="checked"`)
+	selectedBytes = []byte(` selected="selected"`)
 )
 
-var CompiledRegexpMap map[string]*regexp.Regexp
+// Filler holds a configuration compiled by NewFiller. It is never modified
+// afterwards, so a single Filler can be shared by all request goroutines.
+// Each fill keeps its own scratch state.
+type Filler struct {
+	opts FillInFormOptions
+}
+
+// fillState is the per-call state of a fill.
+type fillState struct {
+	*Filler
+	data    DataSource
+	err     error // first error found while filling
+	aborted bool  // a FieldHook stopped the fill
+
+	// dataFor, when set, picks the data of each form, formTag is nil for
+	// controls outside of forms
+	dataFor func(formTag *tag) DataSource
 
-func init() {
-	createRegexpMap()
+	cur       *formState            // the owner of the control being filled
+	formsByID map[string]*formState // kept across the fills of a Writer
+	outside   *formState            // controls outside of forms
 }
 
-func compileMultiLine(regstr string) *regexp.Regexp {
-	return regexp.MustCompile(`(?msi:` + regstr + `)`)
+// formState is the state of filling the controls of one form.
+type formState struct {
+	id     string
+	skip   bool // not a target
+	data   DataSource
+	params map[string]*param
+	counts map[string]int // fields of each name filled so far
 }
 
-func createRegexpMap() {
-	CompiledRegexpMap = make(map[string]*regexp.Regexp)
-	CompiledRegexpMap["form"] = compileMultiLine(startFormRxp + `.*?` + endFormRxp)
-	CompiledRegexpMap["start form"] = compileMultiLine(`(` + startFormRxp + `)`)
+// param holds the values of a name and where they were found.
+type param struct {
+	vals   [][]byte
+	exists bool
+	src    DataSource // the source, or layer, that had the values
+	path   []string   // the keys of the name in src
 
-	CompiledRegexpMap["input"] = compileMultiLine(inputRxp)
-	CompiledRegexpMap["select"] = compileMultiLine(startSelectRxp + `.*?` + endSelectRxp)
-	CompiledRegexpMap["textarea"] = compileMultiLine(startTextareaRxp + `.*?` + endTextareaRxp)
+	typed     []interface{}
+	typedDone bool
+}
 
-	CompiledRegexpMap["id"] = compileMultiLine(_Id + `=(` + attrValueRxp + `)`)
-	CompiledRegexpMap["type"] = compileMultiLine(_Type + `=(` + attrValueRxp + `)`)
-	CompiledRegexpMap["value"] = compileMultiLine(_Value + `=(` + attrValueRxp + `)`)
-	CompiledRegexpMap["name"] = compileMultiLine(_Name + `=(` + attrValueRxp + `)`)
+// NewFiller returns a Filler configured by opts.
+func NewFiller(opts ...Option) (*Filler, error) {
+	f := &Filler{opts: defaultOptions()}
+	for _, opt := range opts {
+		if err := opt(&f.opts); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
 
-	CompiledRegexpMap["checked"] = compileMultiLine(checkedRxp)
-	CompiledRegexpMap["space+>"] = compileMultiLine(spaceRxp + `*(/?)>\z`)
-	CompiledRegexpMap["space+checked"] = compileMultiLine(spaceRxp + checkedRxp)
-	CompiledRegexpMap["value(nocapture)"] = compileMultiLine(_Value + `=` + attrValueRxp)
-	CompiledRegexpMap["textarea(3capture)"] = compileMultiLine(`(` + startTextareaRxp + `)(.*?)(` + endTextareaRxp + `)`)
-	CompiledRegexpMap["multiple"] = compileMultiLine(multipleRxp)
-	CompiledRegexpMap["option"] = compileMultiLine(startOptionRxp + `(.*?)` + endOptionRxp)
-	CompiledRegexpMap["option(nocapture)"] = compileMultiLine(startOptionRxp + `.*?` + endOptionRxp)
-	CompiledRegexpMap["selected"] = compileMultiLine(selectedRxp)
-	CompiledRegexpMap["start option"] = compileMultiLine(startOptionRxp)
-	CompiledRegexpMap["tag end"] = compileMultiLine(spaceRxp + `*>\z`)
-	CompiledRegexpMap["space+selected"] = compileMultiLine(spaceRxp + selectedRxp)
+func (f *Filler) newState(data map[string][]string) *fillState {
+	return f.newSourceState(Map(data))
 }
 
-func (f Filler) compiledRegexp(key string) *regexp.Regexp {
-	if reg, ok := CompiledRegexpMap[key]; ok {
-		return reg
+func (f *Filler) newSourceState(srcs ...DataSource) *fillState {
+	var data DataSource = Layers(srcs)
+	if len(srcs) == 1 {
+		data = srcs[0]
 	}
-	panic(fmt.Sprintf("no such compiled exp for: %v\n", key))
+	s := &fillState{Filler: f, data: data, formsByID: make(map[string]*formState)}
+	s.cur = s.newFormState(nil, false)
+	return s
 }
 
-// Options for fillin
-// Set { "FillPassword": true } if fillin value to field type="password".
-// Target is id for form tag.
-type FillInFormOptions struct {
-	IgnoreFields map[string]bool
-	IgnoreTypes  map[string]bool
-	FillPassword bool
-	Target       string
+// newFormState returns the state of the form started by formTag, or of the
+// controls outside of forms when formTag is nil.
+func (f *fillState) newFormState(formTag *tag, inTemplate bool) *formState {
+	form := &formState{data: f.data, params: make(map[string]*param), counts: make(map[string]int)}
+	if formTag != nil {
+		id, _ := formTag.get(_Id)
+		form.id = string(decodeEntity(id))
+		form.skip = !f.isTarget(formTag) || inTemplate && !f.opts.FillTemplates
+	}
+	if f.dataFor != nil {
+		form.data = f.dataFor(formTag)
+		// forms without data are left untouched
+		form.skip = form.skip || form.data == nil
+	}
+	return form
 }
 
-type Filler struct {
-	FillInFormOptions
-	Params map[string][][]byte
-	Data   map[string][]string
-}
-
-type Writer struct {
-	filler *Filler
-	wr     io.Writer
-}
-
-func setOptions(options map[string]interface{}) *FillInFormOptions {
-	var ffo FillInFormOptions
-	// default set
-	ffo.IgnoreFields = make(map[string]bool)
-	ffo.IgnoreTypes = make(map[string]bool)
-	ffo.IgnoreTypes["password"] = true
-	ffo.IgnoreTypes["submit"] = true
-	ffo.IgnoreTypes["image"] = true
-	ffo.Target = ""
-
-	for key, val := range options {
-		switch key {
-		case "IgnoreFields":
-			if valArray, ok := val.([]string); ok {
-				for _, val := range valArray {
-					ffo.IgnoreFields[val] = true
-				}
-			}
-		case "IgnoreTypes":
-			if valArray, ok := val.([]string); ok {
-				for _, val := range valArray {
-					ffo.IgnoreTypes[val] = true
-				}
-			}
-		case "FillPassword":
-			if valBool, ok := val.(bool); ok {
-				ffo.IgnoreTypes["password"] = !valBool
-			}
-		case "Target":
-			if valStr, ok := val.(string); ok {
-				ffo.Target = valStr
-			}
-		}
+func newFiller(data map[string][]string, options map[string]interface{}) (*fillState, error) {
+	f, err := NewFiller(WithOptions(options))
+	if err != nil {
+		return nil, err
 	}
-
-	return &ffo
+	return f.newState(data), nil
 }
 
-func newFiller(data map[string][]string, options map[string]interface{}) *Filler {
-	ffo := setOptions(options)
-	return &Filler{Data: data, Params: make(map[string][][]byte), FillInFormOptions: *ffo}
+// return filled formed html.
+// On a *ParseError the html is returned as well, with the malformed parts
+// passed through unfilled.
+func Fill(body []byte, data map[string][]string, options map[string]interface{}) ([]byte, error) {
+	filler, err := newFiller(data, options)
+	if err != nil {
+		return nil, err
+	}
+	return filler.fill(body)
 }
 
-// return writer implement interface io.Writer.
-func FillWriter(wr io.Writer, data map[string][]string, options map[string]interface{}) io.Writer {
-	filler := newFiller(data, options)
-	return Writer{filler: filler, wr: wr}
+// Fill returns body with its forms filled with data.
+// Errors are reported as by the package level Fill.
+func (f *Filler) Fill(body []byte, data map[string][]string) ([]byte, error) {
+	return f.newState(data).fill(body)
 }
-func (w Writer) Write(p []byte) (int, error) {
-	filled := w.filler.fill(p)
-	return w.wr.Write(filled)
+
+// FillPlan returns the document of p with its forms filled with data.
+func (f *Filler) FillPlan(p *Plan, data map[string][]string) ([]byte, error) {
+	if err := f.checkSize(len(p.src)); err != nil {
+		return nil, err
+	}
+	s := f.newState(data)
+	out := s.fillPlan(p)
+	return out, s.err
 }
 
-// return filled formed html.
-func Fill(body []byte, data map[string][]string, options map[string]interface{}) []byte {
-	filler := newFiller(data, options)
-	return filler.fill(body)
+func (f *fillState) fill(body []byte) ([]byte, error) {
+	if err := f.checkSize(len(body)); err != nil {
+		return nil, err
+	}
+	p, err := compile(body)
+	out := f.fillPlan(p)
+	if err == nil || f.aborted {
+		err = f.err
+	}
+	return out, err
 }
 
-func (f Filler) fill(body []byte) []byte {
-	return f.compiledRegexp("form").ReplaceAllFunc(body, f.fillForm)
+func (f *Filler) checkSize(n int) error {
+	if f.opts.MaxSize > 0 && n > f.opts.MaxSize {
+		return ErrTooLarge
+	}
+	return nil
 }
 
-func (f Filler) fillForm(formbody []byte) []byte {
-	// process only form with target id
-	if f.FillInFormOptions.Target != "" {
-		formTag := f.compiledRegexp("start form").FindSubmatch(formbody)
-		if len(formTag) == 2 {
-			if id := f.getId(formTag[1]); !bytes.Equal(id, []byte{}) {
-				if string(id) != f.FillInFormOptions.Target {
-					return formbody
-				}
+// isTarget reports whether the form started by formTag is to be filled.
+func (f *Filler) isTarget(formTag *tag) bool {
+	o := &f.opts
+	if o.Target == "" && len(o.TargetIDs) == 0 && len(o.TargetNames) == 0 &&
+		len(o.TargetActions) == 0 && o.TargetFunc == nil {
+		return true
+	}
+	// process only form with target id, name or action
+	targeted := false
+	if o.Target != "" || len(o.TargetIDs) > 0 {
+		if id, _ := formTag.get(_Id); len(id) > 0 {
+			id = decodeEntity(id)
+			if string(id) == o.Target || o.TargetIDs[string(id)] {
+				return true
 			}
+			targeted = true
 		}
 	}
+	for _, attr := range []struct {
+		name string
+		set  map[string]bool
+	}{{_Name, o.TargetNames}, {_Action, o.TargetActions}} {
+		if len(attr.set) == 0 {
+			continue
+		}
+		if v, _ := formTag.get(attr.name); len(v) > 0 {
+			if attr.set[string(decodeEntity(v))] {
+				return true
+			}
+			targeted = true
+		}
+	}
+	if o.TargetFunc != nil {
+		if o.TargetFunc(formAttrs(formTag)) {
+			return true
+		}
+		targeted = true
+	}
+	return !targeted && !o.StrictTarget
+}
 
-	replaced := f.compiledRegexp("input").ReplaceAllFunc(formbody, f.fillInput)
-	replaced = f.compiledRegexp("select").ReplaceAllFunc(replaced, f.fillSelect)
-	replaced = f.compiledRegexp("textarea").ReplaceAllFunc(replaced, f.fillTextarea)
-
-	return replaced
+// formAttrs returns the attributes of t keyed by lower case name, the first
+// one of each name wins.
+func formAttrs(t *tag) map[string]string {
+	attrs := make(map[string]string, len(t.attrs))
+	for _, a := range t.attrs {
+		name := strings.ToLower(string(a.name))
+		if _, dup := attrs[name]; !dup {
+			attrs[name] = string(decodeEntity(a.value))
+		}
+	}
+	return attrs
 }
 
-func (f Filler) unquote(tag []byte) []byte {
-	return bytes.Trim(tag, `'"`)
+// ignoreField reports whether the fields named name are left untouched.
+func (f *Filler) ignoreField(name []byte) bool {
+	if _, ok := f.opts.IgnoreFields[string(name)]; ok {
+		return true
+	}
+	if matchAny(f.opts.IgnoreFieldPatterns, string(name)) {
+		return true
+	}
+	if len(f.opts.FillOnly) > 0 && !matchAny(f.opts.FillOnly, string(name)) {
+		return true
+	}
+	return isCSRFName(name)
 }
 
-func (f Filler) getId(tag []byte) []byte {
-	id := f.compiledRegexp("id").FindSubmatch(tag)
-	if len(id) == 2 {
-		return f.unquote(id[1])
+// ignoreType reports whether the input c is left untouched for its type,
+// either the normalized one or, for unknown types such as the legacy
+// datetime, the type attribute as written.
+func (f *Filler) ignoreType(c *control) bool {
+	// password is not filled by default
+	if c.inputType == "password" && !f.opts.FillPassword {
+		return true
 	}
-	return []byte{}
+	for _, typ := range []string{c.inputType, c.typeAttr} {
+		if flg, ok := f.opts.IgnoreTypes[typ]; ok && flg {
+			return true
+		}
+		if typ != "" && matchAny(f.opts.IgnoreTypePatterns, typ) {
+			return true
+		}
+	}
+	return false
 }
 
-func (f Filler) getType(tag []byte) []byte {
-	itype := f.compiledRegexp("type").FindSubmatch(tag)
-	if len(itype) == 2 {
-		return f.unquote(itype[1])
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
 	}
-	return []byte{}
+	return false
 }
 
-func (f Filler) getValue(tag []byte) []byte {
-	value := f.compiledRegexp("value").FindSubmatch(tag)
-	if len(value) == 2 {
-		return f.unquote(value[1])
+// isCSRFName reports whether name is the name of a CSRF token field, such as
+// csrf_token, _csrf, X-XSRF-TOKEN, authenticity_token (Rails), _token
+// (Laravel) or __RequestVerificationToken (ASP.NET). Those are never filled,
+// a stale token must not be replayed into a fresh page.
+func isCSRFName(name []byte) bool {
+	lower := bytes.ToLower(name)
+	if bytes.Contains(lower, []byte(`csrf`)) || bytes.Contains(lower, []byte(`xsrf`)) {
+		return true
 	}
-	return []byte{}
+	switch string(lower) {
+	case `authenticity_token`, `_token`, `__requestverificationtoken`:
+		return true
+	}
+	return false
 }
 
-func (f Filler) getName(tag []byte) []byte {
-	name := f.compiledRegexp("name").FindSubmatch(tag)
-	if len(name) == 2 {
-		return f.unquote(name[1])
+func (f *Filler) escapeHTML(tag []byte) []byte {
+	out := make([]byte, 0, len(tag)+8)
+	last := 0
+	for i, c := range tag {
+		var esc []byte
+		switch c {
+		case '&':
+			esc = ampBytes
+		case '<':
+			esc = ltBytes
+		case '>':
+			esc = gtBytes
+		case '"':
+			esc = quotBytes
+		default:
+			continue
+		}
+		out = append(out, tag[last:i]...)
+		out = append(out, esc...)
+		last = i + 1
 	}
-	return []byte{}
+	return append(out, tag[last:]...)
 }
 
-func (f Filler) escapeHTML(tag []byte) []byte {
-	return bytes.Replace(bytes.Replace(bytes.Replace(bytes.Replace(tag, []byte{'&'}, ampBytes, -1), []byte{'<'}, ltBytes, -1), []byte{'>'}, gtBytes, -1), []byte{'"'}, quotBytes, -1)
+func (f *fillState) getParam(name string) ([][]byte, bool) {
+	p := f.param(name)
+	if !p.exists {
+		return [][]byte{}, false
+	}
+	return p.vals, true
 }
 
-func (f Filler) getParam(name string) ([][]byte, bool) {
+// param returns the values of name, looked up once per fill.
+func (f *fillState) param(name string) *param {
 	// like cache
-	if param, ok := f.Params[name]; ok {
-		return param, true
+	if p, ok := f.cur.params[name]; ok {
+		return p
 	}
-	if param, ok := f.Data[name]; ok {
-		vals := make([][]byte, len(param))
-		for i, val := range param {
-			vals[i] = []byte(val)
+	vals, src, path, ok := f.lookup(f.cur.data, name)
+	p := &param{exists: ok, src: src, path: path}
+	if ok {
+		p.vals = make([][]byte, len(vals))
+		for i, val := range vals {
+			p.vals[i] = []byte(val)
 		}
-		f.Params[name] = vals
-		return f.Params[name], true
 	}
+	f.cur.params[name] = p
+	return p
+}
 
-	return [][]byte{}, false
+// nextValue returns the value for the next field named name in the form.
+// Fields of the same name take the values in document order, the way
+// browsers submit them. A field past the last value has none.
+func (f *fillState) nextValue(name string) ([]byte, bool) {
+	vals, exists := f.getParam(name)
+	i := f.cur.counts[name]
+	f.cur.counts[name] = i + 1
+	if exists && i < len(vals) {
+		return vals[i], true
+	}
+	return nil, false
 }
 
-func (f Filler) fillInput(tag []byte) []byte {
-	inputType := f.getType(tag)
-	if bytes.Equal(inputType, []byte{}) {
-		inputType = []byte("text")
+// keep reports whether a field of type typ is left as in the template under
+// the missing policy, given whether it has a value and whether that is empty.
+func (f *Filler) keep(typ string, exists, empty bool) bool {
+	policy, ok := f.opts.MissingTypes[typ]
+	if !ok {
+		policy = f.opts.Missing
+	}
+	switch policy {
+	case MissingPreserve:
+		return !exists || empty
+	case MissingPresentOnly:
+		return !exists
 	}
+	return false
+}
 
-	// ignore types (password is default true (not fillin))
-	if flg, ok := f.IgnoreTypes[string(inputType)]; ok && flg {
-		return tag
+// lookup returns the values of name in src, taking them from the first layer
+// that has them when src is Layers. Nested names are resolved by a
+// NestedSource when the NestedNames option is set. from is the source that
+// had the values and path the keys they were found by.
+func (f *fillState) lookup(src DataSource, name string) (vals []string, from DataSource, path []string, ok bool) {
+	if src == nil {
+		// a nil source has no values
+		return nil, nil, nil, false
+	}
+	layers, isLayers := src.(Layers)
+	if !isLayers {
+		if vals, ok := src.Values(name); ok {
+			return vals, src, []string{name}, true
+		}
+		if ns, nested := src.(NestedSource); nested && f.opts.NestedNames {
+			if path := splitName(name); len(path) > 1 || len(path) == 1 && path[0] != name {
+				vals, ok := ns.Lookup(path)
+				return vals, src, path, ok
+			}
+		}
+		return nil, nil, nil, false
 	}
+	for _, layer := range layers {
+		lvals, lfrom, lpath, lok := f.lookup(layer, name)
+		if !lok {
+			continue
+		}
+		if !f.opts.FallThroughEmpty || !isEmpty(lvals) {
+			return lvals, lfrom, lpath, true
+		}
+		if !ok {
+			vals, from, path, ok = lvals, lfrom, lpath, true
+		}
+	}
+	return vals, from, path, ok
+}
 
-	name := string(f.getName(tag))
-	if _, ok := f.IgnoreFields[name]; ok {
-		return tag
+// isEmpty reports whether vals holds no value other than "".
+func isEmpty(vals []string) bool {
+	for _, v := range vals {
+		if v != "" {
+			return false
+		}
 	}
-	paramValues, exists := f.getParam(name)
+	return true
+}
 
-	if bytes.Equal(inputType, checkboxBytes) || bytes.Equal(inputType, radioBytes) {
-		value := f.getValue(tag)
+func isEmptyBytes(vals [][]byte) bool {
+	for _, v := range vals {
+		if len(v) > 0 {
+			return false
+		}
+	}
+	return true
+}
 
-		tag = f.compiledRegexp("space+checked").ReplaceAll(tag, blankBytes)
+func (f *fillState) fillInput(src []byte, c *control) []byte {
+	t := &c.tag
+	inputType := c.inputType
+
+	if f.ignoreType(c) {
+		return src[t.start:t.end]
+	}
+
+	if !c.hasName {
+		return src[t.start:t.end]
+	}
+	if f.ignoreField(c.name) {
+		return src[t.start:t.end]
+	}
+	if inputType == "hidden" && !f.opts.FillHidden["*"] && !f.opts.FillHidden[string(c.name)] {
+		return src[t.start:t.end]
+	}
+	if inputType == "checkbox" || inputType == "radio" {
+		paramValues, exists := f.getParam(string(c.name))
+		paramValues, exists, ok := f.runHook(src, c, paramValues, exists)
+		if !ok || f.keep(inputType, exists, isEmptyBytes(paramValues)) {
+			return src[t.start:t.end]
+		}
+		var add []byte
 		for _, paramValue := range paramValues {
-			if bytes.Equal(paramValue, value) {
-				if !f.compiledRegexp("checked").Match(tag) {
-					tag = f.compiledRegexp("space+>").ReplaceAll(tag, checkedBytes)
-				}
+			if bytes.Equal(paramValue, c.value) {
+				add = checkedBytes
+				break
 			}
 		}
-	} else { // if bytes.Equal(inputType, textBytes)
-		var paramValue []byte
-		if !exists {
-			paramValue = []byte("")
-		} else {
-			paramValue = paramValues[0]
-		}
-		escapedValue := f.escapeHTML(paramValue)
-		reg := f.compiledRegexp("value(nocapture)")
-		if reg.Match(tag) {
-			tag = reg.ReplaceAll(tag, append([]byte(`value="`), append(escapedValue, doubleQuotBytes...)...))
-		} else {
-			tag = f.compiledRegexp("space+>").ReplaceAll(tag, append([]byte(` value="`), append(escapedValue, []byte(`"$1>`)...)...))
-		}
+		return t.rewrite(src, _Checked, "", nil, add)
 	}
 
-	return tag
+	paramValue, exists := f.nextValue(string(c.name))
+	if _, typed := typedInputs[inputType]; typed && exists {
+		name := string(c.name)
+		paramValue = f.formatInput(inputType, name, f.param(name), f.cur.counts[name]-1, paramValue)
+	}
+	paramValue, exists, ok := f.hookValue(src, c, paramValue, exists)
+	if !ok || f.keep(inputType, exists, len(paramValue) == 0) {
+		return src[t.start:t.end]
+	}
+	return t.rewrite(src, "", _Value, f.escapeHTML(paramValue), nil)
 }
 
-func (f Filler) fillTextarea(tag []byte) []byte {
-	name := string(f.getName(tag))
-	if _, ok := f.IgnoreFields[name]; ok {
-		return tag
+func (f *fillState) fillTextarea(src []byte, c *control) []byte {
+	if !c.hasName {
+		return src[c.tag.start:c.end]
 	}
-	paramValues, exists := f.getParam(name)
-	var paramValue []byte
-	if !exists {
-		paramValue = []byte("")
-	} else {
-		paramValue = paramValues[0]
+	if f.ignoreField(c.name) {
+		return src[c.tag.start:c.end]
+	}
+	paramValue, exists := f.nextValue(string(c.name))
+	paramValue, exists, ok := f.hookValue(src, c, paramValue, exists)
+	if !ok || f.keep(_Textarea, exists, len(paramValue) == 0) {
+		return src[c.tag.start:c.end]
 	}
-	tag = f.compiledRegexp("textarea(3capture)").ReplaceAll(tag, append([]byte(`${1}`), append(f.escapeHTML(paramValue), []byte(`${3}`)...)...))
 
-	return tag
+	out := make([]byte, 0, c.end-c.tag.start+len(paramValue))
+	out = append(out, src[c.tag.start:c.tag.end]...)
+	out = append(out, f.escapeHTML(paramValue)...)
+	return append(out, src[c.content:c.end]...)
 }
 
-func (f Filler) fillSelect(tag []byte) []byte {
-	name := string(f.getName(tag))
-	if _, ok := f.IgnoreFields[name]; ok {
-		return tag
+func (f *fillState) fillSelect(src []byte, c *control) []byte {
+	if !c.hasName {
+		return src[c.tag.start:c.end]
 	}
-	paramValues, exists := f.getParam(name)
-
-	if exists {
-		if !f.compiledRegexp("multiple").Match(tag) {
-			paramValues = paramValues[:1]
+	if f.ignoreField(c.name) {
+		return src[c.tag.start:c.end]
+	}
+	var paramValues [][]byte
+	var exists bool
+	if _, multiple := c.tag.get(_Multiple); multiple {
+		paramValues, exists = f.getParam(string(c.name))
+	} else {
+		var paramValue []byte
+		if paramValue, exists = f.nextValue(string(c.name)); exists {
+			paramValues = [][]byte{paramValue}
 		}
 	}
+	paramValues, exists, ok := f.runHook(src, c, paramValues, exists)
+	if !ok || f.keep(_Select, exists, isEmptyBytes(paramValues)) {
+		return src[c.tag.start:c.end]
+	}
 
-	return f.compiledRegexp("option(nocapture)").ReplaceAllFunc(tag,
-		func(tag []byte) []byte {
-			return f.fillOption(tag, paramValues)
-		})
-}
-
-func (f Filler) fillOption(tag []byte, paramValues [][]byte) []byte {
-	value := f.getValue(tag)
-	if bytes.Equal(value, []byte{}) {
-		value = f.compiledRegexp("option").ReplaceAll(tag, []byte(`$1`))
+	out := make([]byte, 0, c.end-c.tag.start+len(selectedBytes))
+	last := c.tag.start
+	for i := range c.options {
+		o := &c.options[i]
+		out = append(out, src[last:o.tag.start]...)
+		out = append(out, f.fillOption(src, o, paramValues)...)
+		last = o.end
 	}
+	return append(out, src[last:c.end]...)
+}
 
-	tag = f.compiledRegexp("space+selected").ReplaceAll(tag, blankBytes)
+func (f *fillState) fillOption(src []byte, o *option, paramValues [][]byte) []byte {
+	var add []byte
 	for _, paramValue := range paramValues {
-		if bytes.Equal(paramValue, value) {
-			if !f.compiledRegexp("selected").Match(tag) {
-				tag = f.compiledRegexp("start option").ReplaceAllFunc(tag,
-					func(tag []byte) []byte {
-						return f.compiledRegexp("tag end").ReplaceAll(tag, selectedBytes)
-					})
-			}
+		if bytes.Equal(paramValue, o.value) {
+			add = selectedBytes
+			break
 		}
 	}
-	return tag
+	if _, selected := o.tag.get(_Selected); add == nil && !selected {
+		return src[o.tag.start:o.end]
+	}
+	out := o.tag.rewrite(src, _Selected, "", nil, add)
+	return append(out, src[o.tag.end:o.end]...)
 }
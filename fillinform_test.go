@@ -6,63 +6,53 @@ import (
 	"testing"
 )
 
+// testControl compiles the single control in s.
+func testControl(s string) ([]byte, *control) {
+	src := []byte(s)
+	t, _ := nextTag(src, 0)
+	c, _, _ := compileControl(src, t)
+	return src, &c
+}
+
+// testOption compiles the single option in s.
+func testOption(s string) ([]byte, *option) {
+	src := []byte(s)
+	return src, &compileOptions(src, 0)[0]
+}
+
 func TestOnepass(t *testing.T) {
 	re := regexp.MustCompile("x?")
 	re.MatchString("y")
 }
 
 func TestUnquote(t *testing.T) {
-	filler := &Filler{}
-
-	hoge := filler.unquote([]byte(`"hoge"`))
-	if string(hoge) != "hoge" {
-		t.Errorf("double unquote error %v", hoge)
-	}
-	hoge = filler.unquote([]byte(`'hoge'`))
-	if string(hoge) != "hoge" {
-		t.Errorf("single unquote error %v", hoge)
-	}
-	hoge = filler.unquote([]byte(`'hoge"`))
-	if string(hoge) != "hoge" {
-		t.Errorf("single double unquote error %v", hoge)
-	}
-	hoge = filler.unquote([]byte(`"hoge'`))
-	if string(hoge) != "hoge" {
-		t.Errorf("double single unquote error %v", hoge)
-	}
-	hoge = filler.unquote([]byte(`hoge`))
-	if string(hoge) != "hoge" {
-		t.Errorf("no unquote error %v", hoge)
-	}
-	hoge = filler.unquote([]byte(`"'hoge'"`))
-	if string(hoge) != "hoge" {
-		t.Errorf("no unquote error %v", hoge)
-	}
-	hoge = filler.unquote([]byte(`"'"hoge"'"`))
-	if string(hoge) != "hoge" {
-		t.Errorf("no unquote error %v", hoge)
-	}
-	hoge = filler.unquote([]byte(`'''hoge'''`))
-	if string(hoge) != "hoge" {
-		t.Errorf("no unquote error %v", hoge)
+	tests := map[string]string{
+		`"hoge"`:     `hoge`,
+		`'hoge'`:     `hoge`,
+		`'hoge"`:     `'hoge"`,
+		`"hoge'`:     `"hoge'`,
+		`hoge`:       `hoge`,
+		`"'hoge'"`:   `'hoge'`,
+		`"'"hoge"'"`: `'"hoge"'`,
+		`'''hoge'''`: `''hoge''`,
+		`''"hoge''"`: `''"hoge''"`,
+		`"''"`:       `''`,
+		`""`:         ``,
+		`"`:          `"`,
 	}
-	hoge = filler.unquote([]byte(`''"hoge''"`))
-	if string(hoge) != "hoge" {
-		t.Errorf("no unquote error %v", hoge)
-	}
-	hoge = filler.unquote([]byte(`"''"`))
-	if string(hoge) != "" {
-		t.Errorf("no unquote error %v", hoge)
+	for src, want := range tests {
+		if hoge := unquote([]byte(src)); string(hoge) != want {
+			t.Errorf("unquote %s error %s", src, hoge)
+		}
 	}
 }
 
 func BenchmarkUnquote(b *testing.B) {
 	str := `"hoge"`
 	bstr := []byte(str)
-	filler := &Filler{}
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		filler.unquote(bstr)
+		unquote(bstr)
 	}
 }
 
@@ -75,9 +65,9 @@ var TesteeArray = map[string]string{
 }
 
 func TestGetType(t *testing.T) {
-	filler := &Filler{}
 	for key, val := range TesteeArray {
-		hoge := filler.getType([]byte(val))
+		tag, _ := parseTag([]byte(val), 0, true)
+		hoge, _ := tag.get(_Type)
 		if string(hoge) != "hoge" {
 			t.Errorf("error in %v", key)
 		}
@@ -87,17 +77,17 @@ func TestGetType(t *testing.T) {
 func BenchmarkGetType(b *testing.B) {
 	str := `<input type="hoge" value="hoge" name="hoge">`
 	bstr := []byte(str)
-	filler := &Filler{}
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		filler.getType(bstr)
+		tag, _ := parseTag(bstr, 0, true)
+		tag.get(_Type)
 	}
 }
 
 func TestGetValue(t *testing.T) {
-	filler := &Filler{}
 	for key, val := range TesteeArray {
-		hoge := filler.getValue([]byte(val))
+		tag, _ := parseTag([]byte(val), 0, true)
+		hoge, _ := tag.get(_Value)
 		if string(hoge) != "hoge" {
 			t.Errorf("error in %v", key)
 		}
@@ -107,17 +97,17 @@ func TestGetValue(t *testing.T) {
 func BenchmarkGetValue(b *testing.B) {
 	str := `<input value="hoge" type="hoge" name="hoge">`
 	bstr := []byte(str)
-	filler := &Filler{}
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		filler.getValue(bstr)
+		tag, _ := parseTag(bstr, 0, true)
+		tag.get(_Value)
 	}
 }
 
 func TestGetName(t *testing.T) {
-	filler := &Filler{}
 	for key, val := range TesteeArray {
-		hoge := filler.getName([]byte(val))
+		tag, _ := parseTag([]byte(val), 0, true)
+		hoge, _ := tag.get(_Name)
 		if string(hoge) != "hoge" {
 			t.Errorf("error in %v", key)
 		}
@@ -127,10 +117,10 @@ func TestGetName(t *testing.T) {
 func BenchmarkGetName(b *testing.B) {
 	str := `<input name="hoge" type="hoge" value="hoge">`
 	bstr := []byte(str)
-	filler := &Filler{}
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		filler.getName(bstr)
+		tag, _ := parseTag(bstr, 0, true)
+		tag.get(_Name)
 	}
 }
 
@@ -170,29 +160,29 @@ func TestFillInput(t *testing.T) {
 		"chk":   []string{"chkval"},
 		"rdo":   []string{"rdoval2"},
 	}
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
 
-	htmlstr := filler.fillInput([]byte(`<input type="text" name="title"/>`))
+	htmlstr := filler.fillInput(testControl(`<input type="text" name="title"/>`))
 	if string(htmlstr) != `<input type="text" name="title" value="hoge &amp; Hoge &lt;&quot;Title&quot;&gt;"/>` {
 		t.Errorf("fillInput error: %v", string(htmlstr))
 	}
 
-	htmlstr = filler.fillInput([]byte(`<input type="checkbox" name="chk" value="chkval" checked=checked/>`))
+	htmlstr = filler.fillInput(testControl(`<input type="checkbox" name="chk" value="chkval" checked=checked/>`))
 	if string(htmlstr) != `<input type="checkbox" name="chk" value="chkval" checked="checked"/>` {
 		t.Errorf("no affect error: %v", string(htmlstr))
 	}
 
-	htmlstr = filler.fillInput([]byte(`<input type="radio" name="rdo" value="rdoval1" checked=checked/>`))
+	htmlstr = filler.fillInput(testControl(`<input type="radio" name="rdo" value="rdoval1" checked=checked/>`))
 	if string(htmlstr) != `<input type="radio" name="rdo" value="rdoval1"/>` {
 		t.Errorf("fillout error: %v", string(htmlstr))
 	}
 
-	htmlstr = filler.fillInput([]byte(`<input type="radio" name="rdo" value="rdoval2" />`))
+	htmlstr = filler.fillInput(testControl(`<input type="radio" name="rdo" value="rdoval2" />`))
 	if string(htmlstr) != `<input type="radio" name="rdo" value="rdoval2" checked="checked"/>` {
 		t.Errorf("fillin error: %v", string(htmlstr))
 	}
 
-	htmlstr = filler.fillInput([]byte(`<input type="submit" value="Send">`))
+	htmlstr = filler.fillInput(testControl(`<input type="submit" value="Send">`))
 	if string(htmlstr) != `<input type="submit" value="Send">` {
 		t.Errorf("no fill error: %v", string(htmlstr))
 	}
@@ -204,11 +194,13 @@ func BenchmarkFillInput(b *testing.B) {
 		"chk":   []string{"chkval"},
 		"rdo":   []string{"rdoval2"},
 	}
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
+
+	src, c := testControl(`<input type="radio" name="rdo" value="rdoval2" />`)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		filler.fillInput([]byte(`<input type="radio" name="rdo" value="rdoval2" />`))
+		filler.fillInput(src, c)
 	}
 }
 
@@ -216,17 +208,19 @@ func TestFillTextarea(t *testing.T) {
 	formData := map[string][]string{
 		"body": []string{"hoge & hoge <hoge@hogehoge>"},
 	}
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
 
-	htmlstr := filler.fillTextarea([]byte(`<textarea id="body" name="body" cols="80" rows="20" placeholder="hoge"></textarea>`))
+	htmlstr := filler.fillTextarea(testControl(`<textarea id="body" name="body" cols="80" rows="20" placeholder="hoge"></textarea>`))
 	if string(htmlstr) != `<textarea id="body" name="body" cols="80" rows="20" placeholder="hoge">hoge &amp; hoge &lt;hoge@hogehoge&gt;</textarea>` {
 		t.Errorf("fillTextarea error: %v", string(htmlstr))
 	}
-	htmlstr = filler.fillTextarea([]byte(`<textarea id="body" name="body" cols="80" rows="20" placeholder="hoge">gakuburu</textarea>`))
+	filler, _ = newFiller(formData, nil)
+	htmlstr = filler.fillTextarea(testControl(`<textarea id="body" name="body" cols="80" rows="20" placeholder="hoge">gakuburu</textarea>`))
 	if string(htmlstr) != `<textarea id="body" name="body" cols="80" rows="20" placeholder="hoge">hoge &amp; hoge &lt;hoge@hogehoge&gt;</textarea>` {
 		t.Errorf("fillTextarea error: %v", string(htmlstr))
 	}
-	htmlstr = filler.fillTextarea([]byte(`<textarea id="body" name="bodyX" cols="80" rows="20" placeholder="hoge">gakuburu</textarea>`))
+	filler, _ = newFiller(formData, nil)
+	htmlstr = filler.fillTextarea(testControl(`<textarea id="body" name="bodyX" cols="80" rows="20" placeholder="hoge">gakuburu</textarea>`))
 	if string(htmlstr) != `<textarea id="body" name="bodyX" cols="80" rows="20" placeholder="hoge"></textarea>` {
 		t.Errorf("no affect error: %v", string(htmlstr))
 	}
@@ -236,11 +230,13 @@ func BenchmarkFillTextarea(b *testing.B) {
 	formData := map[string][]string{
 		"body": []string{"hoge & hoge <hoge@hogehoge>"},
 	}
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
+
+	src, c := testControl(`<textarea id="body" name="body" cols="80" rows="20" placeholder="hoge"></textarea>`)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		filler.fillTextarea([]byte(`<textarea id="body" name="body" cols="80" rows="20" placeholder="hoge"></textarea>`))
+		filler.fillTextarea(src, c)
 	}
 }
 
@@ -248,9 +244,9 @@ func TestFillSelect(t *testing.T) {
 	formData := map[string][]string{
 		"select": []string{"1"},
 	}
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
 
-	htmlstr := filler.fillSelect([]byte(`<select name="select">
+	htmlstr := filler.fillSelect(testControl(`<select name="select">
     <option value="1" selected="selected">1</option>
     <option value="2">2</option>
     <option value="3">3</option>
@@ -270,7 +266,8 @@ func TestFillSelect(t *testing.T) {
 		t.Errorf("fillTextarea error: %v", string(htmlstr))
 	}
 
-	htmlstr = filler.fillSelect([]byte(`<select name="select">
+	filler, _ = newFiller(formData, nil)
+	htmlstr = filler.fillSelect(testControl(`<select name="select">
     <option value="1">1</option>
     <option value="2" selected="selected">2</option>
     <option value="3">3</option>
@@ -289,7 +286,8 @@ func TestFillSelect(t *testing.T) {
 		t.Errorf("fillTextarea error: %v", string(htmlstr))
 	}
 
-	htmlstr = filler.fillSelect([]byte(`<select name="selectX">
+	filler, _ = newFiller(formData, nil)
+	htmlstr = filler.fillSelect(testControl(`<select name="selectX">
     <option value="1">1</option>
     <option value="2" selected="selected">2</option>
     <option value="3">3</option>
@@ -311,8 +309,8 @@ func TestFillSelect(t *testing.T) {
 	formData2 := map[string][]string{
 		"select": []string{"1", "3"},
 	}
-	filler2 := newFiller(formData2, nil)
-	htmlstr = filler2.fillSelect([]byte(`<select multiple="multiple" name="select">
+	filler2, _ := newFiller(formData2, nil)
+	htmlstr = filler2.fillSelect(testControl(`<select multiple="multiple" name="select">
     <option value="1">1</option>
     <option value="2" selected="selected">2</option>
     <option value="3">3</option>
@@ -331,7 +329,7 @@ func TestFillSelect(t *testing.T) {
 		t.Errorf("multiple error: %v", string(htmlstr))
 	}
 
-	htmlstr = filler2.fillSelect([]byte(`<select name="select">
+	htmlstr = filler2.fillSelect(testControl(`<select name="select">
     <option value="1">1</option>
     <option value="2" selected="selected">2</option>
     <option value="3">3</option>
@@ -355,18 +353,20 @@ func BenchmarkFillSelect(b *testing.B) {
 	formData := map[string][]string{
 		"select": []string{"1"},
 	}
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		filler.fillSelect([]byte(`<select name="select">
+	src, c := testControl(`<select name="select">
     <option value="1">1</option>
     <option value="2" selected="selected">2</option>
     <option value="3">3</option>
     <option value="4">4</option>
     <option value="5">5</option>
     <option value="6">6</option>
-  </select>`))
+  </select>`)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filler.fillSelect(src, c)
 	}
 }
 
@@ -378,18 +378,21 @@ func TestFillOption(t *testing.T) {
 		"select": []string{"1"},
 		"body":   []string{"hogehoge"},
 	}
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
 
-	htmlstr := filler.fillOption([]byte(`<option value="1">1</option>`), [][]byte{[]byte(`1`)})
+	src, o := testOption(`<option value="1">1</option>`)
+	htmlstr := filler.fillOption(src, o, [][]byte{[]byte(`1`)})
 	if string(htmlstr) != `<option value="1" selected="selected">1</option>` {
 		t.Errorf("fillOption error: %v", string(htmlstr))
 	}
 
-	htmlstr = filler.fillOption([]byte(`<option value="1">1</option>`), [][]byte{[]byte(`2`)})
+	src, o = testOption(`<option value="1">1</option>`)
+	htmlstr = filler.fillOption(src, o, [][]byte{[]byte(`2`)})
 	if string(htmlstr) != `<option value="1">1</option>` {
 		t.Errorf("fillOption error: %v", string(htmlstr))
 	}
-	htmlstr = filler.fillOption([]byte(`<option>1</option>`), [][]byte{[]byte(`1`)})
+	src, o = testOption(`<option>1</option>`)
+	htmlstr = filler.fillOption(src, o, [][]byte{[]byte(`1`)})
 	if string(htmlstr) != `<option selected="selected">1</option>` {
 		t.Errorf("fillOption error: %v", string(htmlstr))
 	}
@@ -404,11 +407,13 @@ func BenchmarkFillOption(b *testing.B) {
 		"select": []string{"1"},
 		"body":   []string{"hogehoge"},
 	}
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
+
+	src, o := testOption(`<option value="1">1</option>`)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		filler.fillOption([]byte(`<option value="1">1</option>`), [][]byte{[]byte(`1`)})
+		filler.fillOption(src, o, [][]byte{[]byte(`1`)})
 	}
 }
 
@@ -455,9 +460,9 @@ func TestFillinForm(t *testing.T) {
 		"body":   []string{"hogehoge"},
 	}
 
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
 
-	htmlstr := filler.fill([]byte(HTML))
+	htmlstr, _ := filler.fill([]byte(HTML))
 
 	if string(htmlstr) != HTMLSuccess {
 		t.Errorf("fillinform error: %v", string(htmlstr))
@@ -473,7 +478,7 @@ func BenchmarkFillinForm(b *testing.B) {
 		"body":   []string{"hogehoge"},
 	}
 
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -490,9 +495,9 @@ func TestFillinForm2(t *testing.T) {
 		"body":   []string{"hogehoge"},
 	}
 
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
 
-	htmlstr := filler.fill([]byte(HTML))
+	htmlstr, _ := filler.fill([]byte(HTML))
 
 	if string(htmlstr) != HTMLSuccess {
 		t.Errorf("fillinform error: %v", string(htmlstr))
@@ -551,7 +556,7 @@ var HTMLMultiSuccess = `
 </form>
 
 <form id="myform2" action="./" method="POST">
-  <input type="hidden" name="hidden" value=""/>
+  <input type="hidden" name="hidden"/>
   <input type="password" name="pass"/>
   <input type="text" name="title" value="hogeTitle"/>
   <input type="checkbox" name="chk" value="chkval"/>
@@ -649,23 +654,23 @@ func TestFillinFormOptions(t *testing.T) {
 		"pass":   []string{"hogepass"},
 	}
 
-	filler := newFiller(formData, map[string]interface{}{"Target": "myform2"})
+	filler, _ := newFiller(formData, map[string]interface{}{"Target": "myform2"})
 
-	htmlstr := filler.fill([]byte(HTMLMulti))
+	htmlstr, _ := filler.fill([]byte(HTMLMulti))
 
 	if string(htmlstr) != HTMLMultiSuccess {
 		t.Errorf("fillinform error: %v", string(htmlstr))
 	}
 
-	filler = newFiller(formData, map[string]interface{}{"FillPassword": true})
-	htmlstr = filler.fill([]byte(HTMLPassword))
+	filler, _ = newFiller(formData, map[string]interface{}{"FillPassword": true})
+	htmlstr, _ = filler.fill([]byte(HTMLPassword))
 
 	if string(htmlstr) != HTMLPasswordSuccess {
 		t.Errorf("fillinform error: %v", string(htmlstr))
 	}
 
-	filler = newFiller(formData, map[string]interface{}{"IgnoreFields": []string{"title", "rdo"}})
-	htmlstr = filler.fill([]byte(HTMLFields))
+	filler, _ = newFiller(formData, map[string]interface{}{"IgnoreFields": []string{"title", "rdo"}})
+	htmlstr, _ = filler.fill([]byte(HTMLFields))
 
 	if string(htmlstr) != HTMLFieldsSuccess {
 		t.Errorf("fillinform error: %v", string(htmlstr))
@@ -1190,9 +1195,9 @@ func TestBigHTML(t *testing.T) {
 		".site_token":      []string{"t0.tSEbWYjOBNbOEfuBNV_Zqa6JVg4"},
 	}
 
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
 
-	htmlstr := filler.fill([]byte(HTMLBig))
+	htmlstr, _ := filler.fill([]byte(HTMLBig))
 
 	if string(htmlstr) != HTMLBigSuccess {
 		t.Errorf("fillinform error: %s", string(htmlstr))
@@ -1212,10 +1217,219 @@ func BenchmarkBigHTML(b *testing.B) {
 		".site_token":      []string{"t0.tSEbWYjOBNbOEfuBNV_Zqa6JVg4"},
 	}
 
-	filler := newFiller(formData, nil)
+	filler, _ := newFiller(formData, nil)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		filler.fill([]byte(HTMLBig))
 	}
 }
+
+func TestFillerConcurrent(t *testing.T) {
+	filler, _ := NewFiller(WithOptions(map[string]interface{}{"FillPassword": true}))
+	plan, _ := Compile([]byte(HTMLPassword))
+
+	formData := map[string][]string{
+		"title":  []string{"hogeTitle"},
+		"chk":    []string{"1"},
+		"rdo":    []string{"rdoval2"},
+		"select": []string{"1"},
+		"body":   []string{"hogehoge"},
+		"pass":   []string{"hogepass"},
+	}
+
+	done := make(chan bool)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			defer func() { done <- true }()
+			for j := 0; j < 50; j++ {
+				if i%2 == 0 {
+					if htmlstr, _ := filler.Fill([]byte(HTMLPassword), formData); string(htmlstr) != HTMLPasswordSuccess {
+						t.Errorf("concurrent fill error: %s", htmlstr)
+					}
+				} else {
+					if htmlstr, _ := filler.FillPlan(plan, formData); string(htmlstr) != HTMLPasswordSuccess {
+						t.Errorf("concurrent plan fill error: %s", htmlstr)
+					}
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+}
+
+func TestSuccessiveValues(t *testing.T) {
+	formData := map[string][]string{
+		"tel":    []string{"03", "1234", "5678"},
+		"note":   []string{"first", "second"},
+		"pref":   []string{"2", "1"},
+		"chk":    []string{"a", "c"},
+		"multi":  []string{"1", "2"},
+		"single": []string{"only"},
+	}
+	src := `<form><input name="tel">-<input name="tel">-<input name="tel"><input name="tel">
+<textarea name="note"></textarea><textarea name="note">x</textarea><textarea name="note">y</textarea>
+<select name="pref"><option>1</option><option>2</option></select><select name="pref"><option>1</option><option>2</option></select>
+<input type="checkbox" name="chk" value="a"><input type="checkbox" name="chk" value="b"><input type="checkbox" name="chk" value="c">
+<select name="multi" multiple><option>1</option><option>2</option></select><select name="multi" multiple><option>1</option><option>2</option></select>
+<input name="single"><input name="single"></form>
+<form><input name="tel"></form>`
+	want := `<form><input name="tel" value="03">-<input name="tel" value="1234">-<input name="tel" value="5678"><input name="tel" value="">
+<textarea name="note">first</textarea><textarea name="note">second</textarea><textarea name="note"></textarea>
+<select name="pref"><option>1</option><option selected="selected">2</option></select><select name="pref"><option selected="selected">1</option><option>2</option></select>
+<input type="checkbox" name="chk" value="a" checked="checked"><input type="checkbox" name="chk" value="b"><input type="checkbox" name="chk" value="c" checked="checked">
+<select name="multi" multiple><option selected="selected">1</option><option selected="selected">2</option></select><select name="multi" multiple><option selected="selected">1</option><option selected="selected">2</option></select>
+<input name="single" value="only"><input name="single" value=""></form>
+<form><input name="tel" value="03"></form>`
+
+	htmlstr, _ := Fill([]byte(src), formData, nil)
+	if string(htmlstr) != want {
+		t.Errorf("successive values error: %v", string(htmlstr))
+	}
+
+	var buf bytes.Buffer
+	w := FillWriter(&buf, formData, nil)
+	for i := 0; i < len(src); i += 7 {
+		end := i + 7
+		if end > len(src) {
+			end = len(src)
+		}
+		w.Write([]byte(src[i:end]))
+	}
+	w.Close()
+	if buf.String() != want {
+		t.Errorf("writer successive values error: %v", buf.String())
+	}
+}
+
+func TestHiddenFields(t *testing.T) {
+	formData := map[string][]string{
+		".site_token":        []string{"stale"},
+		"step":               []string{"2"},
+		"csrf_token":         []string{"stale"},
+		"authenticity_token": []string{"stale"},
+		"X-XSRF-TOKEN":       []string{"stale"},
+		"title":              []string{"hogeTitle"},
+	}
+	src := `<form><input type="hidden" name=".site_token" value="fresh"><input type="hidden" name="step" value="1"><input type="hidden" name="csrf_token" value="fresh"><input type="hidden" name="authenticity_token" value="fresh"><input name="X-XSRF-TOKEN" value="fresh"><input name="title"></form>`
+
+	htmlstr, _ := Fill([]byte(src), formData, nil)
+	if string(htmlstr) != `<form><input type="hidden" name=".site_token" value="fresh"><input type="hidden" name="step" value="1"><input type="hidden" name="csrf_token" value="fresh"><input type="hidden" name="authenticity_token" value="fresh"><input name="X-XSRF-TOKEN" value="fresh"><input name="title" value="hogeTitle"></form>` {
+		t.Errorf("hidden fields error: %v", string(htmlstr))
+	}
+
+	htmlstr, _ = Fill([]byte(src), formData, map[string]interface{}{"FillHidden": []string{"step", "csrf_token"}})
+	if string(htmlstr) != `<form><input type="hidden" name=".site_token" value="fresh"><input type="hidden" name="step" value="2"><input type="hidden" name="csrf_token" value="fresh"><input type="hidden" name="authenticity_token" value="fresh"><input name="X-XSRF-TOKEN" value="fresh"><input name="title" value="hogeTitle"></form>` {
+		t.Errorf("fill hidden error: %v", string(htmlstr))
+	}
+
+	filler, _ := NewFiller(WithFillHidden("*"))
+	htmlstr, _ = filler.Fill([]byte(src), formData)
+	if string(htmlstr) != `<form><input type="hidden" name=".site_token" value="stale"><input type="hidden" name="step" value="2"><input type="hidden" name="csrf_token" value="fresh"><input type="hidden" name="authenticity_token" value="fresh"><input name="X-XSRF-TOKEN" value="fresh"><input name="title" value="hogeTitle"></form>` {
+		t.Errorf("fill all hidden error: %v", string(htmlstr))
+	}
+}
+
+func TestCaseInsensitiveTypes(t *testing.T) {
+	formData := map[string][]string{
+		"chk":   []string{"1"},
+		"rdo":   []string{"2"},
+		"pass":  []string{"hogepass"},
+		"date":  []string{"2021-01-03"},
+		"sel":   []string{"1", "2"},
+		"title": []string{"hoge"},
+		"tok":   []string{"stale"},
+	}
+	src := `<FORM METHOD="Post"><INPUT TYPE="Checkbox" NAME="chk" VALUE="1"><Input Type=RADIO Name=rdo Value=1 CHECKED><input type="Radio" name="rdo" value="2"><input type="PASSWORD" name="pass"><input type="Date" name="date"><SELECT NAME="sel" MULTIPLE><OPTION VALUE="1">1</OPTION><OPTION VALUE="2" SELECTED>2</OPTION></SELECT><input type="unknown" name="title"><input type="HIDDEN" name="tok" value="fresh"></FORM>`
+	want := `<FORM METHOD="Post"><INPUT TYPE="Checkbox" NAME="chk" VALUE="1" checked="checked"><Input Type=RADIO Name=rdo Value=1><input type="Radio" name="rdo" value="2" checked="checked"><input type="PASSWORD" name="pass"><input type="Date" name="date" value="2021-01-03"><SELECT NAME="sel" MULTIPLE><OPTION VALUE="1" selected="selected">1</OPTION><OPTION VALUE="2" selected="selected">2</OPTION></SELECT><input type="unknown" name="title" value="hoge"><input type="HIDDEN" name="tok" value="fresh"></FORM>`
+
+	htmlstr, _ := Fill([]byte(src), formData, nil)
+	if string(htmlstr) != want {
+		t.Errorf("case insensitive types error: %v", string(htmlstr))
+	}
+
+	filler, _ := NewFiller(WithIgnoreTypes("CheckBox"), WithMissing(MissingPreserve, "Text"))
+	htmlstr, _ = filler.Fill([]byte(`<form><INPUT TYPE="Checkbox" NAME="chk" VALUE="2" CHECKED><input NAME="x" value="keep"></form>`), formData)
+	if string(htmlstr) != `<form><INPUT TYPE="Checkbox" NAME="chk" VALUE="2" CHECKED><input NAME="x" value="keep"></form>` {
+		t.Errorf("case insensitive options error: %v", string(htmlstr))
+	}
+
+	// unknown types are ignored by the type as written, too
+	for _, opts := range []map[string]interface{}{
+		{"IgnoreTypes": []string{"DateTime"}},
+		{"IgnoreTypeGlobs": []string{"date*"}},
+	} {
+		htmlstr, _ = Fill([]byte(`<form><input type="datetime" name="title" value="keep"><input type="unknown" name="title"></form>`), formData, opts)
+		if string(htmlstr) != `<form><input type="datetime" name="title" value="keep"><input type="unknown" name="title" value="hoge"></form>` {
+			t.Errorf("ignore unknown type error: %v", string(htmlstr))
+		}
+	}
+}
+
+func TestEntityMatching(t *testing.T) {
+	formData := map[string][]string{
+		"dept": []string{"R&D"},
+		"city": []string{"Tokyo", "São Paulo"},
+		"chk":  []string{`"quoted"`, "<b>"},
+		"rdo":  []string{"a'b"},
+	}
+	src := `<form><select name="dept"><option value="Sales">Sales</option><option value="R&amp;D">R&amp;D</option></select>
+<select name="city" multiple><option>&nbsp;Tokyo </option><option>S&atilde;o
+  Paulo</option><option>Osaka</option></select>
+<input type="checkbox" name="chk" value="&quot;quoted&quot;"><input type="checkbox" name="chk" value="&#60;b&#x3e;"><input type="checkbox" name="chk" value="&amp;quot;quoted&amp;quot;">
+<input type="radio" name="rdo" value="a&apos;b"></form>`
+	want := `<form><select name="dept"><option value="Sales">Sales</option><option value="R&amp;D" selected="selected">R&amp;D</option></select>
+<select name="city" multiple><option selected="selected">&nbsp;Tokyo </option><option selected="selected">S&atilde;o
+  Paulo</option><option>Osaka</option></select>
+<input type="checkbox" name="chk" value="&quot;quoted&quot;" checked="checked"><input type="checkbox" name="chk" value="&#60;b&#x3e;" checked="checked"><input type="checkbox" name="chk" value="&amp;quot;quoted&amp;quot;">
+<input type="radio" name="rdo" value="a&apos;b" checked="checked"></form>`
+
+	htmlstr, _ := Fill([]byte(src), formData, nil)
+	if string(htmlstr) != want {
+		t.Errorf("entity matching error: %v", string(htmlstr))
+	}
+}
+
+func TestFormAttribute(t *testing.T) {
+	formData := map[string][]string{"q": []string{"a", "b"}, "title": []string{"hogeTitle", "fuga"}}
+	src := `<input name="q" form="search"><form id="search"><input name="q"></form><form id="other"><input name="title"></form><input name="title" form="other"><input name="title" form="none"><input name="title">`
+
+	htmlstr, _ := Fill([]byte(src), formData, nil)
+	if string(htmlstr) != `<input name="q" form="search" value="a"><form id="search"><input name="q" value="b"></form><form id="other"><input name="title" value="hogeTitle"></form><input name="title" form="other" value="fuga"><input name="title" form="none"><input name="title">` {
+		t.Errorf("form attribute error: %v", string(htmlstr))
+	}
+
+	htmlstr, _ = Fill([]byte(src), formData, map[string]interface{}{"Target": "search"})
+	if string(htmlstr) != `<input name="q" form="search" value="a"><form id="search"><input name="q" value="b"></form><form id="other"><input name="title"></form><input name="title" form="other"><input name="title" form="none"><input name="title">` {
+		t.Errorf("form attribute target error: %v", string(htmlstr))
+	}
+
+	// the form attribute wins over the enclosing form
+	htmlstr, _ = Fill([]byte(`<form id="a"><input name="title" form="b"></form><form id="b"></form>`), formData, map[string]interface{}{"Target": "a"})
+	if string(htmlstr) != `<form id="a"><input name="title" form="b"></form><form id="b"></form>` {
+		t.Errorf("form attribute owner error: %v", string(htmlstr))
+	}
+
+	htmlstr, _ = Fill([]byte(`<input name="title" form="a&amp;b"><form id="a&#38;b"></form>`), formData, nil)
+	if string(htmlstr) != `<input name="title" form="a&amp;b" value="hogeTitle"><form id="a&#38;b"></form>` {
+		t.Errorf("form attribute entity error: %v", string(htmlstr))
+	}
+}
+
+func TestFillOutside(t *testing.T) {
+	formData := map[string][]string{"title": []string{"hogeTitle", "fuga"}, "mode": []string{"b"}}
+	src := `<div><input name="title"><select name="mode"><option>a</option><option>b</option></select></div><input name="title" form="none"><form><input name="title"></form>`
+
+	filler, _ := NewFiller(WithFillOutside(true))
+	htmlstr, _ := filler.Fill([]byte(src), formData)
+	if string(htmlstr) != `<div><input name="title" value="hogeTitle"><select name="mode"><option>a</option><option selected="selected">b</option></select></div><input name="title" form="none" value="fuga"><form><input name="title" value="hogeTitle"></form>` {
+		t.Errorf("fill outside error: %v", string(htmlstr))
+	}
+
+	htmlstr, _ = Fill([]byte(`<template><input name="title"></template><input name="title">`), formData, map[string]interface{}{"FillOutside": true})
+	if string(htmlstr) != `<template><input name="title"></template><input name="title" value="hogeTitle">` {
+		t.Errorf("fill outside template error: %v", string(htmlstr))
+	}
+}
@@ -0,0 +1,107 @@
+package fillinform
+
+import (
+	"errors"
+)
+
+// ErrSkipField is returned by a FieldHook to leave the control untouched.
+var ErrSkipField = errors.New("fillinform: skip field")
+
+// FieldHook is called for every control before it is filled, with the values
+// it is about to be filled with: the value of an input, textarea or select,
+// or all values of the name for checkboxes, radios and multiple selects.
+// values is nil when the data has no value. The returned values are filled
+// instead, a nil result counts as no value for the Missing policy.
+//
+// Returning ErrSkipField, or an error wrapping it, leaves the control
+// untouched. Any other error stops the fill: the control and all after it
+// are left untouched and the error is returned. A Filler may call its hook
+// from several goroutines.
+type FieldHook func(field *Field, values []string) ([]string, error)
+
+// Field describes a control passed to a FieldHook. Attribute values and
+// textarea content have their character references decoded.
+type Field struct {
+	Tag     string // input, select or textarea
+	Type    string // input type in lower case as written, select or textarea
+	Name    string
+	ID      string
+	FormID  string // id of the owning form, empty when it has none
+	Value   string // value, textarea content or first selected option
+	Checked bool   // a checked checkbox or radio
+}
+
+// newField describes c, taken from src.
+func newField(src []byte, c *control, formID string) *Field {
+	field := &Field{Type: c.inputType, Name: string(c.name), FormID: formID}
+	if id, ok := c.tag.get(_Id); ok {
+		field.ID = string(decodeEntity(id))
+	}
+	switch c.kind {
+	case controlInput:
+		field.Tag = _Input
+		if c.typeAttr != "" {
+			// unknown types too, such as the legacy datetime
+			field.Type = c.typeAttr
+		}
+		field.Value = string(c.value)
+		_, field.Checked = c.tag.get(_Checked)
+	case controlSelect:
+		field.Tag, field.Type = _Select, _Select
+		for i := range c.options {
+			if _, selected := c.options[i].tag.get(_Selected); selected {
+				field.Value = string(c.options[i].value)
+				break
+			}
+		}
+	case controlTextarea:
+		field.Tag, field.Type = _Textarea, _Textarea
+		field.Value = string(decodeEntity(src[c.tag.end:c.content]))
+	}
+	return field
+}
+
+// runHook passes the values for c to the FieldHook, if any, and returns the
+// values to fill c with. ok is false when c is to be left untouched.
+func (f *fillState) runHook(src []byte, c *control, vals [][]byte, exists bool) (out [][]byte, outExists, ok bool) {
+	if f.opts.FieldHook == nil {
+		return vals, exists, true
+	}
+	var in []string
+	if exists {
+		in = make([]string, len(vals))
+		for i, v := range vals {
+			in[i] = string(v)
+		}
+	}
+	res, err := f.opts.FieldHook(newField(src, c, f.cur.id), in)
+	if errors.Is(err, ErrSkipField) {
+		return nil, false, false
+	}
+	if err != nil {
+		f.err = err
+		f.aborted = true
+		return nil, false, false
+	}
+	if res == nil {
+		return nil, false, true
+	}
+	out = make([][]byte, len(res))
+	for i, v := range res {
+		out[i] = []byte(v)
+	}
+	return out, true, true
+}
+
+// hookValue is runHook for a control taking a single value.
+func (f *fillState) hookValue(src []byte, c *control, val []byte, exists bool) ([]byte, bool, bool) {
+	var vals [][]byte
+	if exists {
+		vals = [][]byte{val}
+	}
+	vals, exists, ok := f.runHook(src, c, vals, exists)
+	if len(vals) == 0 {
+		return nil, exists, ok
+	}
+	return vals[0], exists, ok
+}
@@ -0,0 +1,92 @@
+package fillinform
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFieldHook(t *testing.T) {
+	formData := map[string][]string{
+		"title": []string{"hogeTitle"},
+		"card":  []string{"4111111111111111"},
+		"chk":   []string{"1"},
+		"sel":   []string{"b"},
+		"body":  []string{"hoge"},
+		"tel":   []string{"03"},
+	}
+	src := `<form id="f"><input id="t" name="title" value="a&amp;b"><input name="card"><input type="checkbox" name="chk" value="1" checked><select name="sel"><option selected>a</option><option>b</option></select><textarea name="body">x &lt; y</textarea><input type="TEL" name="tel"><input type="datetime" name="none"></form>`
+
+	var fields []Field
+	var values [][]string
+	filler, _ := NewFiller(WithFieldHook(func(field *Field, vals []string) ([]string, error) {
+		fields = append(fields, *field)
+		values = append(values, vals)
+		switch field.Name {
+		case "card":
+			return []string{"************" + vals[0][12:]}, nil
+		case "tel":
+			return nil, fmt.Errorf("masking %s: %w", field.Name, ErrSkipField)
+		case "none":
+			return []string{"added"}, nil
+		}
+		return vals, nil
+	}))
+	htmlstr, err := filler.Fill([]byte(src), formData)
+	if err != nil {
+		t.Fatalf("field hook error: %v", err)
+	}
+	if string(htmlstr) != `<form id="f"><input id="t" name="title" value="hogeTitle"><input name="card" value="************1111"><input type="checkbox" name="chk" value="1" checked="checked"><select name="sel"><option>a</option><option selected="selected">b</option></select><textarea name="body">hoge</textarea><input type="TEL" name="tel"><input type="datetime" name="none" value="added"></form>` {
+		t.Errorf("field hook error: %v", string(htmlstr))
+	}
+
+	want := []Field{
+		{Tag: "input", Type: "text", Name: "title", ID: "t", FormID: "f", Value: "a&b"},
+		{Tag: "input", Type: "text", Name: "card", FormID: "f"},
+		{Tag: "input", Type: "checkbox", Name: "chk", FormID: "f", Value: "1", Checked: true},
+		{Tag: "select", Type: "select", Name: "sel", FormID: "f", Value: "a"},
+		{Tag: "textarea", Type: "textarea", Name: "body", FormID: "f", Value: "x < y"},
+		{Tag: "input", Type: "tel", Name: "tel", FormID: "f"},
+		{Tag: "input", Type: "datetime", Name: "none", FormID: "f"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("field hook fields error: %+v", fields)
+	}
+	if values[0][0] != "hogeTitle" || values[6] != nil {
+		t.Errorf("field hook values error: %v", values)
+	}
+}
+
+func TestFieldHookAbort(t *testing.T) {
+	formData := map[string][]string{"title": []string{"hoge"}, "secret": []string{"x"}, "body": []string{"fuga"}}
+	errSecret := errors.New("secret field")
+	hook := func(field *Field, vals []string) ([]string, error) {
+		if strings.HasPrefix(field.Name, "secret") {
+			return nil, errSecret
+		}
+		return vals, nil
+	}
+	src := `<form><input name="title"><input name="secret"><input name="body"></form>`
+
+	htmlstr, err := Fill([]byte(src), formData, map[string]interface{}{"FieldHook": hook})
+	if err != errSecret {
+		t.Errorf("field hook abort error: %v", err)
+	}
+	if string(htmlstr) != `<form><input name="title" value="hoge"><input name="secret"><input name="body"></form>` {
+		t.Errorf("field hook abort error: %v", string(htmlstr))
+	}
+
+	var buf bytes.Buffer
+	w := FillWriter(&buf, formData, map[string]interface{}{"FieldHook": hook})
+	w.Write([]byte(src))
+	w.Write([]byte(`<form><input name="title"></form><form>`))
+	if err := w.Close(); err != errSecret {
+		t.Errorf("writer field hook abort error: %v", err)
+	}
+	if buf.String() != `<form><input name="title" value="hoge"><input name="secret"><input name="body"></form><form><input name="title"></form><form>` {
+		t.Errorf("writer field hook abort error: %v", buf.String())
+	}
+}
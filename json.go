@@ -0,0 +1,53 @@
+package fillinform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var errJSONNotObject = errors.New("fillinform: JSON document is not an object")
+
+// FillJSON fills body with the values of the JSON object jsonDoc.
+// Scalars become single values and arrays multiple values, null counts as
+// missing. Nested objects and arrays are reached by nested names like
+// user[address][city] or items[0][qty]. Numbers are kept as written, so 1973
+// selects <option value="1973">.
+func FillJSON(body []byte, jsonDoc []byte, options map[string]interface{}) ([]byte, error) {
+	filler, err := NewFiller(WithOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	return filler.FillJSON(body, jsonDoc)
+}
+
+// FillJSON fills body with the values of the JSON object jsonDoc, as the
+// package level FillJSON does.
+func (f *Filler) FillJSON(body []byte, jsonDoc []byte) ([]byte, error) {
+	doc, err := decodeJSON(jsonDoc)
+	if err != nil {
+		return nil, err
+	}
+	g := *f
+	g.opts.NestedNames = true
+	return g.FillSource(body, doc)
+}
+
+// decodeJSON decodes the JSON object b with its numbers left as json.Number.
+func decodeJSON(b []byte) (AnyMap, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("fillinform: trailing data after JSON document")
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errJSONNotObject
+	}
+	return AnyMap(m), nil
+}
@@ -0,0 +1,43 @@
+package fillinform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFillJSON(t *testing.T) {
+	doc := `{
+		"title": "hogeTitle",
+		"chk": 1,
+		"rdo": "rdoval2",
+		"select": [1],
+		"body": "hogehoge",
+		"pass": null
+	}`
+	htmlstr, err := FillJSON([]byte(HTMLMulti), []byte(doc), map[string]interface{}{"Target": "myform2"})
+	if err != nil {
+		t.Fatalf("fill json error: %v", err)
+	}
+	if string(htmlstr) != HTMLMultiSuccess {
+		t.Errorf("fillinform error: %v", string(htmlstr))
+	}
+
+	html := `<form><select name="user_birth"><option value="1972">1972</option><option value="1973">1973</option></select><input name="id"><input name="rate"><input name="user[address][city]"><input name="items[1][qty]"><input name="admin"></form>`
+	doc = `{"user_birth": 1973, "id": 12345678901234567890, "rate": 0.1, "user": {"address": {"city": "Tokyo"}}, "items": [{"qty": 1}, {"qty": 2}], "admin": true}`
+	htmlstr, err = FillJSON([]byte(html), []byte(doc), nil)
+	if err != nil {
+		t.Fatalf("fill json error: %v", err)
+	}
+	if string(htmlstr) != `<form><select name="user_birth"><option value="1972">1972</option><option value="1973" selected="selected">1973</option></select><input name="id" value="12345678901234567890"><input name="rate" value="0.1"><input name="user[address][city]" value="Tokyo"><input name="items[1][qty]" value="2"><input name="admin" value="true"></form>` {
+		t.Errorf("fill json error: %v", string(htmlstr))
+	}
+
+	for _, doc := range []string{`[1]`, `"title"`, `{"title": }`, `{} {}`} {
+		if _, err := FillJSON([]byte(html), []byte(doc), nil); err == nil {
+			t.Errorf("json error expected: %s", doc)
+		}
+	}
+	if _, err := FillJSON([]byte(html), []byte(`[]`), nil); err == nil || !strings.Contains(err.Error(), "not an object") {
+		t.Errorf("json error: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package fillinform
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// NestedSource is a DataSource that also resolves nested names such as
+// user[address][city], items[0][qty] or profile.email. With the NestedNames
+// option a name that is not found as is, is split into its keys and looked
+// up by Lookup.
+type NestedSource interface {
+	DataSource
+	Lookup(path []string) (values []string, ok bool)
+}
+
+// Lookup resolves path against the nested maps, slices and structs in m.
+func (m AnyMap) Lookup(path []string) ([]string, bool) {
+	return lookupPath(reflect.ValueOf(map[string]interface{}(m)), path)
+}
+
+type nested struct {
+	v reflect.Value
+}
+
+// Nested returns a NestedSource backed by v, which may be any nesting of
+// maps with string keys, slices, arrays and structs, such as a decoded JSON
+// document or a form model. Struct fields are named as by FillStruct,
+// slice elements by their index. The leaves are converted as the fields of
+// FillStruct are.
+func Nested(v interface{}) NestedSource {
+	return nested{reflect.ValueOf(v)}
+}
+
+func (n nested) Values(name string) ([]string, bool) {
+	return lookupPath(n.v, []string{name})
+}
+
+func (n nested) Lookup(path []string) ([]string, bool) {
+	return lookupPath(n.v, path)
+}
+
+// lookupPath returns the values found by following path from v.
+func lookupPath(v reflect.Value, path []string) ([]string, bool) {
+	leaf, layout, ok := lookupLeaf(v, path)
+	if !ok {
+		return nil, false
+	}
+	vals, ok, err := formatValue(leaf, layout)
+	if err != nil {
+		return nil, false
+	}
+	return vals, ok
+}
+
+// lookupLeaf follows path from v and returns the value found with the layout
+// tag of its struct field.
+func lookupLeaf(v reflect.Value, path []string) (leaf reflect.Value, layout string, ok bool) {
+	for _, key := range path {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return v, "", false
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return v, "", false
+			}
+			v = v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		case reflect.Slice, reflect.Array:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= v.Len() {
+				return v, "", false
+			}
+			v = v.Index(i)
+		case reflect.Struct:
+			v, layout = structField(v, key)
+		default:
+			return v, "", false
+		}
+		if !v.IsValid() {
+			return v, "", false
+		}
+	}
+	return v, layout, true
+}
+
+// structField returns the field of the struct v named key, as FillStruct
+// names it, and its layout tag. The field is invalid when there is none or
+// it is left out.
+func structField(v reflect.Value, key string) (reflect.Value, string) {
+	rt := v.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		name, omitempty := fieldTag(sf)
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && name == "" && isPlainStruct(fv) {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if f, layout := structField(fv, key); f.IsValid() {
+					return f, layout
+				}
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if name != key {
+			continue
+		}
+		if omitempty && fv.IsZero() {
+			return reflect.Value{}, ""
+		}
+		return fv, sf.Tag.Get("layout")
+	}
+	return reflect.Value{}, ""
+}
+
+// splitName splits a nested name like user[address][city], items[0][qty] or
+// profile.email into its keys. A trailing [] is dropped, so tags[] is the
+// list tags.
+func splitName(name string) []string {
+	var path []string
+	start := 0
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '.', '[':
+			if i > start {
+				path = append(path, name[start:i])
+			}
+			start = i + 1
+		case ']':
+			path = append(path, name[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(name) {
+		path = append(path, name[start:])
+	}
+	if n := len(path); n > 0 && path[n-1] == "" {
+		path = path[:n-1]
+	}
+	return path
+}
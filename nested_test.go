@@ -0,0 +1,120 @@
+package fillinform
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitName(t *testing.T) {
+	tests := map[string][]string{
+		"title":                []string{"title"},
+		"user[address][city]":  []string{"user", "address", "city"},
+		"items[0][qty]":        []string{"items", "0", "qty"},
+		"profile.email":        []string{"profile", "email"},
+		"items[0].qty":         []string{"items", "0", "qty"},
+		"tags[]":               []string{"tags"},
+		"user[address].zip[0]": []string{"user", "address", "zip", "0"},
+	}
+	for name, want := range tests {
+		if path := splitName(name); !reflect.DeepEqual(path, want) {
+			t.Errorf("split name error: %s: %v", name, path)
+		}
+	}
+}
+
+type testAddress struct {
+	City string `form:"city"`
+	Zip  string `form:"zip,omitempty"`
+}
+
+type testUser struct {
+	Name    string       `form:"name"`
+	Address *testAddress `form:"address"`
+	Items   []testItem   `form:"items"`
+	Birth   time.Time    `form:"birth" layout:"2006-01-02"`
+	Tags    []string     `form:"tags"`
+	Extra   testAddress
+}
+
+type testItem struct {
+	Qty int `form:"qty"`
+}
+
+func TestNestedLookup(t *testing.T) {
+	user := testUser{
+		Name:    "hoge",
+		Address: &testAddress{City: "Tokyo"},
+		Items:   []testItem{{1}, {2}},
+		Birth:   time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+		Tags:    []string{"a", "b"},
+		Extra:   testAddress{City: "Osaka"},
+	}
+	doc := AnyMap{
+		"user": map[string]interface{}{
+			"address": map[string]interface{}{"city": "Tokyo"},
+			"tags":    []interface{}{"a", "b"},
+		},
+		"items": []interface{}{
+			map[string]interface{}{"qty": 1},
+			map[string]interface{}{"qty": 2},
+		},
+	}
+
+	tests := []struct {
+		src  NestedSource
+		path []string
+		vals []string
+		ok   bool
+	}{
+		{Nested(user), []string{"name"}, []string{"hoge"}, true},
+		{Nested(&user), []string{"address", "city"}, []string{"Tokyo"}, true},
+		{Nested(user), []string{"address", "zip"}, nil, false},
+		{Nested(user), []string{"items", "1", "qty"}, []string{"2"}, true},
+		{Nested(user), []string{"items", "2", "qty"}, nil, false},
+		{Nested(user), []string{"birth"}, []string{"2000-01-02"}, true},
+		{Nested(user), []string{"tags"}, []string{"a", "b"}, true},
+		{Nested(user), []string{"Extra", "city"}, []string{"Osaka"}, true},
+		{Nested(user), []string{"name", "x"}, nil, false},
+		{Nested(user), []string{"address"}, nil, false},
+		{doc, []string{"user", "address", "city"}, []string{"Tokyo"}, true},
+		{doc, []string{"user", "tags"}, []string{"a", "b"}, true},
+		{doc, []string{"items", "0", "qty"}, []string{"1"}, true},
+		{doc, []string{"items", "x", "qty"}, nil, false},
+	}
+	for _, test := range tests {
+		vals, ok := test.src.Lookup(test.path)
+		if ok != test.ok || !reflect.DeepEqual(vals, test.vals) {
+			t.Errorf("nested lookup error: %v: %v, %v", test.path, vals, ok)
+		}
+	}
+}
+
+func TestFillNestedNames(t *testing.T) {
+	html := []byte(`<form><input name="user[address][city]"><input name="profile.email"><input name="items[1][qty]"><select name="user[tags][]" multiple><option>a</option><option>b</option><option>c</option></select><input name="user.address"></form>`)
+	doc := AnyMap{
+		"user": map[string]interface{}{
+			"address": map[string]interface{}{"city": "Tokyo"},
+			"tags":    []string{"a", "c"},
+		},
+		"profile":       map[string]interface{}{"email": "hoge@example.com"},
+		"items":         []map[string]int{{"qty": 1}, {"qty": 2}},
+		"profile.email": "flat@example.com",
+	}
+
+	htmlstr, _ := FillSource(html, doc, map[string]interface{}{"NestedNames": true})
+	if string(htmlstr) != `<form><input name="user[address][city]" value="Tokyo"><input name="profile.email" value="flat@example.com"><input name="items[1][qty]" value="2"><select name="user[tags][]" multiple><option selected="selected">a</option><option>b</option><option selected="selected">c</option></select><input name="user.address" value=""></form>` {
+		t.Errorf("nested names error: %v", string(htmlstr))
+	}
+
+	htmlstr, _ = FillSource(html, doc, nil)
+	if string(htmlstr) != `<form><input name="user[address][city]" value=""><input name="profile.email" value="flat@example.com"><input name="items[1][qty]" value=""><select name="user[tags][]" multiple><option>a</option><option>b</option><option>c</option></select><input name="user.address" value=""></form>` {
+		t.Errorf("nested names off error: %v", string(htmlstr))
+	}
+
+	filler, _ := NewFiller(WithNestedNames(true))
+	htmlstr, _ = filler.FillSource(html, Map{"items[1][qty]": []string{"5"}}, doc)
+	if string(htmlstr) != `<form><input name="user[address][city]" value="Tokyo"><input name="profile.email" value="flat@example.com"><input name="items[1][qty]" value="5"><select name="user[tags][]" multiple><option selected="selected">a</option><option>b</option><option selected="selected">c</option></select><input name="user.address" value=""></form>` {
+		t.Errorf("nested names layers error: %v", string(htmlstr))
+	}
+}
@@ -0,0 +1,520 @@
+package fillinform
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Options for fillin
+// Set { "FillPassword": true } if fillin value to field type="password".
+// IgnoreFieldPatterns and IgnoreTypePatterns leave the matching names and
+// types untouched as IgnoreFields and IgnoreTypes do, and when FillOnly is
+// not empty only the names matching one of its patterns are filled.
+// Target is id for form tag. TargetIDs, TargetNames and TargetActions add
+// more ids, names and actions, TargetFunc a predicate on the attributes of
+// the form. A form matching any of them is filled. Forms that have none of
+// the targeted attributes are filled too unless StrictTarget is set.
+// MaxSize limits the size of a document in bytes (0 means no limit).
+// FallThroughEmpty makes layered sources skip a layer whose values are all empty.
+// NestedNames resolves names like user[address][city] by a NestedSource.
+// Missing is the policy for fields without a value, MissingTypes overrides it
+// per input type, "select" or "textarea".
+// Hidden inputs are filled only when listed in FillHidden ("*" for all).
+// Invalid is the policy for values that are not valid for their input type.
+// FillTemplates fills the controls inside <template> elements.
+// FillOutside fills the controls that belong to no form.
+// FieldHook is called for every control before it is filled.
+type FillInFormOptions struct {
+	IgnoreFields        map[string]bool
+	IgnoreTypes         map[string]bool
+	IgnoreFieldPatterns []*regexp.Regexp
+	IgnoreTypePatterns  []*regexp.Regexp
+	FillOnly            []*regexp.Regexp
+	FillPassword        bool
+	Target              string
+	TargetIDs           map[string]bool
+	TargetNames         map[string]bool
+	TargetActions       map[string]bool
+	TargetFunc          func(attrs map[string]string) bool
+	StrictTarget        bool
+	MaxSize             int
+	FallThroughEmpty    bool
+	NestedNames         bool
+	Missing             MissingPolicy
+	MissingTypes        map[string]MissingPolicy
+	FillHidden          map[string]bool
+	Invalid             InvalidPolicy
+	FillTemplates       bool
+	FillOutside         bool
+	FieldHook           FieldHook
+}
+
+// MissingPolicy decides what happens to a field that has no value in the data.
+type MissingPolicy int
+
+const (
+	// MissingClear clears the field: the value and textarea content are
+	// emptied, checked and selected are removed. This is the default.
+	MissingClear MissingPolicy = iota
+	// MissingPreserve keeps the template default when the name is missing
+	// or its values are empty.
+	MissingPreserve
+	// MissingPresentOnly fills only names present in the data, an empty
+	// value still clears the field.
+	MissingPresentOnly
+)
+
+// Option configures a Filler created by NewFiller.
+type Option func(*FillInFormOptions) error
+
+func defaultOptions() FillInFormOptions {
+	var ffo FillInFormOptions
+	// default set
+	ffo.IgnoreFields = make(map[string]bool)
+	ffo.IgnoreTypes = make(map[string]bool)
+	ffo.IgnoreTypes["submit"] = true
+	ffo.IgnoreTypes["image"] = true
+	ffo.MissingTypes = make(map[string]MissingPolicy)
+	ffo.FillHidden = make(map[string]bool)
+	ffo.Target = ""
+	ffo.TargetIDs = make(map[string]bool)
+	ffo.TargetNames = make(map[string]bool)
+	ffo.TargetActions = make(map[string]bool)
+	return ffo
+}
+
+// WithTarget fills only the form with the given id.
+// Forms without an id are filled as well, unless the target is strict.
+func WithTarget(id string) Option {
+	return func(ffo *FillInFormOptions) error {
+		ffo.Target = id
+		return nil
+	}
+}
+
+// WithTargetIDs fills only the forms with one of the given ids.
+func WithTargetIDs(ids ...string) Option {
+	return func(ffo *FillInFormOptions) error {
+		for _, id := range ids {
+			ffo.TargetIDs[id] = true
+		}
+		return nil
+	}
+}
+
+// WithTargetNames fills only the forms with one of the given names.
+func WithTargetNames(names ...string) Option {
+	return func(ffo *FillInFormOptions) error {
+		for _, name := range names {
+			ffo.TargetNames[name] = true
+		}
+		return nil
+	}
+}
+
+// WithTargetActions fills only the forms with one of the given actions,
+// compared as written in the page.
+func WithTargetActions(actions ...string) Option {
+	return func(ffo *FillInFormOptions) error {
+		for _, action := range actions {
+			ffo.TargetActions[action] = true
+		}
+		return nil
+	}
+}
+
+// WithTargetFunc fills only the forms for which match returns true. match
+// gets the attributes of the form start tag keyed by lower case name, with
+// character references decoded.
+func WithTargetFunc(match func(attrs map[string]string) bool) Option {
+	return func(ffo *FillInFormOptions) error {
+		ffo.TargetFunc = match
+		return nil
+	}
+}
+
+// WithStrictTarget sets whether forms without any of the targeted attributes,
+// such as forms without an id when targeting by id, are skipped. They are
+// filled by default.
+func WithStrictTarget(strict bool) Option {
+	return func(ffo *FillInFormOptions) error {
+		ffo.StrictTarget = strict
+		return nil
+	}
+}
+
+// WithIgnoreFields leaves the named fields untouched.
+func WithIgnoreFields(names ...string) Option {
+	return func(ffo *FillInFormOptions) error {
+		for _, name := range names {
+			ffo.IgnoreFields[name] = true
+		}
+		return nil
+	}
+}
+
+// WithIgnoreTypes leaves inputs of the given types untouched.
+// Types are case-insensitive.
+func WithIgnoreTypes(types ...string) Option {
+	return func(ffo *FillInFormOptions) error {
+		for _, typ := range types {
+			ffo.IgnoreTypes[strings.ToLower(typ)] = true
+		}
+		return nil
+	}
+}
+
+// WithIgnoreFieldGlobs leaves the fields whose names match one of the globs
+// untouched, such as "card_*" or "*_token". * matches any run of characters
+// and ? any single character.
+func WithIgnoreFieldGlobs(globs ...string) Option {
+	return func(ffo *FillInFormOptions) error {
+		for _, glob := range globs {
+			ffo.IgnoreFieldPatterns = append(ffo.IgnoreFieldPatterns, globRegexp(glob, false))
+		}
+		return nil
+	}
+}
+
+// WithIgnoreFieldRegexps leaves the fields whose names match one of the
+// regular expressions untouched. A regular expression matches anywhere in
+// the name unless anchored, as in `^secret\.`.
+func WithIgnoreFieldRegexps(exprs ...string) Option {
+	return func(ffo *FillInFormOptions) (err error) {
+		ffo.IgnoreFieldPatterns, err = appendRegexps(ffo.IgnoreFieldPatterns, "IgnoreFieldRegexps", exprs, false)
+		return err
+	}
+}
+
+// WithIgnoreTypeGlobs leaves inputs whose types match one of the globs
+// untouched. Types are case-insensitive.
+func WithIgnoreTypeGlobs(globs ...string) Option {
+	return func(ffo *FillInFormOptions) error {
+		for _, glob := range globs {
+			ffo.IgnoreTypePatterns = append(ffo.IgnoreTypePatterns, globRegexp(glob, true))
+		}
+		return nil
+	}
+}
+
+// WithIgnoreTypeRegexps leaves inputs whose types match one of the regular
+// expressions untouched. Types are case-insensitive.
+func WithIgnoreTypeRegexps(exprs ...string) Option {
+	return func(ffo *FillInFormOptions) (err error) {
+		ffo.IgnoreTypePatterns, err = appendRegexps(ffo.IgnoreTypePatterns, "IgnoreTypeRegexps", exprs, true)
+		return err
+	}
+}
+
+// WithFillOnlyGlobs fills only the fields whose names match one of the globs,
+// all other fields are left untouched. Ignored fields stay ignored.
+func WithFillOnlyGlobs(globs ...string) Option {
+	return func(ffo *FillInFormOptions) error {
+		for _, glob := range globs {
+			ffo.FillOnly = append(ffo.FillOnly, globRegexp(glob, false))
+		}
+		return nil
+	}
+}
+
+// WithFillOnlyRegexps fills only the fields whose names match one of the
+// regular expressions, all other fields are left untouched.
+func WithFillOnlyRegexps(exprs ...string) Option {
+	return func(ffo *FillInFormOptions) (err error) {
+		ffo.FillOnly, err = appendRegexps(ffo.FillOnly, "FillOnlyRegexps", exprs, false)
+		return err
+	}
+}
+
+// globRegexp returns the regular expression matching what glob matches.
+func globRegexp(glob string, fold bool) *regexp.Regexp {
+	var b strings.Builder
+	if fold {
+		b.WriteString("(?i)")
+	}
+	b.WriteByte('^')
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString("(?s:.*)")
+		case '?':
+			b.WriteString("(?s:.)")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteByte('$')
+	return regexp.MustCompile(b.String())
+}
+
+// appendRegexps compiles exprs and appends them to patterns, a bad expression
+// is reported as an *OptionError for key.
+func appendRegexps(patterns []*regexp.Regexp, key string, exprs []string, fold bool) ([]*regexp.Regexp, error) {
+	for _, expr := range exprs {
+		if fold {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return patterns, &OptionError{Key: key, Msg: err.Error()}
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// WithFillPassword sets whether type="password" inputs are filled.
+// They are not by default. Ignoring the password type still wins.
+func WithFillPassword(fill bool) Option {
+	return func(ffo *FillInFormOptions) error {
+		ffo.FillPassword = fill
+		return nil
+	}
+}
+
+// WithMaxSize limits the size of a document in bytes (0 means no limit).
+func WithMaxSize(n int) Option {
+	return func(ffo *FillInFormOptions) error {
+		if n < 0 {
+			return &OptionError{Key: "MaxSize", Msg: "must not be negative"}
+		}
+		ffo.MaxSize = n
+		return nil
+	}
+}
+
+// WithFillHidden fills the type="hidden" inputs with the given names, "*"
+// fills them all. Hidden inputs are left untouched by default, so submitted
+// data cannot overwrite server generated values. Fields named like CSRF
+// tokens are never filled.
+func WithFillHidden(names ...string) Option {
+	return func(ffo *FillInFormOptions) error {
+		for _, name := range names {
+			ffo.FillHidden[name] = true
+		}
+		return nil
+	}
+}
+
+// WithFallThroughEmpty sets whether a layer of layered sources whose values
+// for a name are all empty is skipped in favour of the next one.
+// By default a submitted empty value wins.
+func WithFallThroughEmpty(fallThrough bool) Option {
+	return func(ffo *FillInFormOptions) error {
+		ffo.FallThroughEmpty = fallThrough
+		return nil
+	}
+}
+
+// WithNestedNames sets whether bracket and dot names like user[address][city],
+// items[0][qty] or profile.email are resolved against nested data when a
+// NestedSource does not have them as is.
+func WithNestedNames(nested bool) Option {
+	return func(ffo *FillInFormOptions) error {
+		ffo.NestedNames = nested
+		return nil
+	}
+}
+
+// WithMissing sets the policy for fields without a value. Without types it
+// is the policy of every field, otherwise of the given input types, "select"
+// and "textarea".
+func WithMissing(policy MissingPolicy, types ...string) Option {
+	return func(ffo *FillInFormOptions) error {
+		if policy < MissingClear || policy > MissingPresentOnly {
+			return &OptionError{Key: "Missing", Msg: fmt.Sprintf("unknown policy %d", policy)}
+		}
+		if len(types) == 0 {
+			ffo.Missing = policy
+		}
+		for _, typ := range types {
+			ffo.MissingTypes[strings.ToLower(typ)] = policy
+		}
+		return nil
+	}
+}
+
+// WithInvalid sets the policy for values that are not valid for the type of
+// their input, such as type="date" or type="number".
+func WithInvalid(policy InvalidPolicy) Option {
+	return func(ffo *FillInFormOptions) error {
+		if policy < InvalidAsIs || policy > InvalidReport {
+			return &OptionError{Key: "Invalid", Msg: fmt.Sprintf("unknown policy %d", policy)}
+		}
+		ffo.Invalid = policy
+		return nil
+	}
+}
+
+// WithFillTemplates sets whether the controls inside <template> elements are
+// filled. They are left untouched by default.
+func WithFillTemplates(fill bool) Option {
+	return func(ffo *FillInFormOptions) error {
+		ffo.FillTemplates = fill
+		return nil
+	}
+}
+
+// WithFillOutside sets whether controls that belong to no form, such as the
+// fields of a fragment rendered on its own, are filled. Controls linked to a
+// form by their form attribute belong to that form either way.
+func WithFillOutside(fill bool) Option {
+	return func(ffo *FillInFormOptions) error {
+		ffo.FillOutside = fill
+		return nil
+	}
+}
+
+// WithFieldHook calls hook for every control before it is filled, to
+// replace its values, skip it or stop the fill.
+func WithFieldHook(hook FieldHook) Option {
+	return func(ffo *FillInFormOptions) error {
+		ffo.FieldHook = hook
+		return nil
+	}
+}
+
+// WithOptions applies options given as a map, the form taken by Fill.
+// Unknown keys and values of the wrong type are reported as *OptionError.
+func WithOptions(options map[string]interface{}) Option {
+	return func(ffo *FillInFormOptions) error {
+		return setOptions(ffo, options)
+	}
+}
+
+func setOptions(ffo *FillInFormOptions, options map[string]interface{}) error {
+	// in a fixed order, so that keys setting the same option give the same
+	// result every time
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := options[key]
+		var opt Option
+		switch key {
+		case "IgnoreFields":
+			if v, ok := val.([]string); ok {
+				opt = WithIgnoreFields(v...)
+			}
+		case "IgnoreTypes":
+			if v, ok := val.([]string); ok {
+				opt = WithIgnoreTypes(v...)
+			}
+		case "IgnoreFieldGlobs":
+			if v, ok := val.([]string); ok {
+				opt = WithIgnoreFieldGlobs(v...)
+			}
+		case "IgnoreFieldRegexps":
+			if v, ok := val.([]string); ok {
+				opt = WithIgnoreFieldRegexps(v...)
+			}
+		case "IgnoreTypeGlobs":
+			if v, ok := val.([]string); ok {
+				opt = WithIgnoreTypeGlobs(v...)
+			}
+		case "IgnoreTypeRegexps":
+			if v, ok := val.([]string); ok {
+				opt = WithIgnoreTypeRegexps(v...)
+			}
+		case "FillOnlyGlobs":
+			if v, ok := val.([]string); ok {
+				opt = WithFillOnlyGlobs(v...)
+			}
+		case "FillOnlyRegexps":
+			if v, ok := val.([]string); ok {
+				opt = WithFillOnlyRegexps(v...)
+			}
+		case "FillPassword":
+			if v, ok := val.(bool); ok {
+				opt = WithFillPassword(v)
+			}
+		case "FillHidden":
+			if v, ok := val.([]string); ok {
+				opt = WithFillHidden(v...)
+			}
+		case "Target":
+			if v, ok := val.(string); ok {
+				opt = WithTarget(v)
+			}
+		case "TargetIDs":
+			if v, ok := val.([]string); ok {
+				opt = WithTargetIDs(v...)
+			}
+		case "TargetNames":
+			if v, ok := val.([]string); ok {
+				opt = WithTargetNames(v...)
+			}
+		case "TargetActions":
+			if v, ok := val.([]string); ok {
+				opt = WithTargetActions(v...)
+			}
+		case "TargetFunc":
+			if v, ok := val.(func(map[string]string) bool); ok {
+				opt = WithTargetFunc(v)
+			}
+		case "StrictTarget":
+			if v, ok := val.(bool); ok {
+				opt = WithStrictTarget(v)
+			}
+		case "MaxSize":
+			if v, ok := val.(int); ok {
+				opt = WithMaxSize(v)
+			}
+		case "FallThroughEmpty":
+			if v, ok := val.(bool); ok {
+				opt = WithFallThroughEmpty(v)
+			}
+		case "NestedNames":
+			if v, ok := val.(bool); ok {
+				opt = WithNestedNames(v)
+			}
+		case "Missing":
+			if v, ok := val.(MissingPolicy); ok {
+				opt = WithMissing(v)
+			}
+		case "MissingTypes":
+			if v, ok := val.(map[string]MissingPolicy); ok {
+				opt = func(ffo *FillInFormOptions) error {
+					for typ, policy := range v {
+						if err := WithMissing(policy, typ)(ffo); err != nil {
+							return err
+						}
+					}
+					return nil
+				}
+			}
+		case "Invalid":
+			if v, ok := val.(InvalidPolicy); ok {
+				opt = WithInvalid(v)
+			}
+		case "FillTemplates":
+			if v, ok := val.(bool); ok {
+				opt = WithFillTemplates(v)
+			}
+		case "FillOutside":
+			if v, ok := val.(bool); ok {
+				opt = WithFillOutside(v)
+			}
+		case "FieldHook":
+			switch v := val.(type) {
+			case FieldHook:
+				opt = WithFieldHook(v)
+			case func(*Field, []string) ([]string, error):
+				opt = WithFieldHook(v)
+			}
+		default:
+			return &OptionError{Key: key, Msg: "unknown option"}
+		}
+		if opt == nil {
+			return &OptionError{Key: key, Msg: fmt.Sprintf("invalid value of type %T", val)}
+		}
+		if err := opt(ffo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package fillinform
+
+import (
+	"testing"
+)
+
+func TestTypedOptions(t *testing.T) {
+	formData := map[string][]string{
+		"title":  []string{"hogeTitle"},
+		"chk":    []string{"1"},
+		"rdo":    []string{"rdoval2"},
+		"select": []string{"1"},
+		"body":   []string{"hogehoge"},
+		"pass":   []string{"hogepass"},
+	}
+
+	tests := []struct {
+		opt     Option
+		html    string
+		success string
+	}{
+		{WithTarget("myform2"), HTMLMulti, HTMLMultiSuccess},
+		{WithFillPassword(true), HTMLPassword, HTMLPasswordSuccess},
+		{WithIgnoreFields("title", "rdo"), HTMLFields, HTMLFieldsSuccess},
+	}
+	for _, test := range tests {
+		filler, err := NewFiller(test.opt)
+		if err != nil {
+			t.Fatalf("new filler error: %v", err)
+		}
+		htmlstr, _ := filler.Fill([]byte(test.html), formData)
+		if string(htmlstr) != test.success {
+			t.Errorf("fillinform error: %v", string(htmlstr))
+		}
+	}
+
+	filler, _ := NewFiller(WithIgnoreTypes("text"))
+	htmlstr, _ := filler.Fill([]byte(`<form><input name="title"></form>`), formData)
+	if string(htmlstr) != `<form><input name="title"></form>` {
+		t.Errorf("ignore types error: %v", string(htmlstr))
+	}
+
+	if _, err := NewFiller(WithMaxSize(-1)); err == nil {
+		t.Errorf("negative MaxSize should fail")
+	}
+}
+
+func TestMapOptions(t *testing.T) {
+	ok := map[string]interface{}{
+		"IgnoreFields": []string{"title"},
+		"IgnoreTypes":  []string{"text"},
+		"FillPassword": true,
+		"Target":       "myform",
+		"MaxSize":      1024,
+	}
+	filler, err := NewFiller(WithOptions(ok))
+	if err != nil {
+		t.Fatalf("map options error: %v", err)
+	}
+	if !filler.opts.IgnoreFields["title"] || !filler.opts.IgnoreTypes["text"] || filler.opts.IgnoreTypes["password"] ||
+		!filler.opts.FillPassword || filler.opts.Target != "myform" || filler.opts.MaxSize != 1024 {
+		t.Errorf("map options error: %+v", filler.opts)
+	}
+
+	for key, val := range map[string]interface{}{
+		"IgnoreField":  []string{"title"},
+		"IgnoreFields": "title",
+		"IgnoreTypes":  []interface{}{"text"},
+		"FillPassword": "true",
+		"Target":       []byte("myform"),
+		"TargetNames":  "login",
+		"StrictTarget": "true",
+		"MaxSize":      int64(1),
+	} {
+		_, err := NewFiller(WithOptions(map[string]interface{}{key: val}))
+		if oerr, ok := err.(*OptionError); !ok || oerr.Key != key {
+			t.Errorf("option error expected for %s: %v", key, err)
+		}
+	}
+}
+
+func TestPasswordOptions(t *testing.T) {
+	formData := map[string][]string{"pass": []string{"hogepass"}}
+	src := `<form><input type="password" name="pass"></form>`
+
+	tests := []struct {
+		options map[string]interface{}
+		success string
+	}{
+		{nil, src},
+		{map[string]interface{}{"FillPassword": true}, `<form><input type="password" name="pass" value="hogepass"></form>`},
+		{map[string]interface{}{"FillPassword": true, "IgnoreTypes": []string{"password"}}, src},
+		{map[string]interface{}{"FillPassword": true, "IgnoreTypes": []string{"text"}}, `<form><input type="password" name="pass" value="hogepass"></form>`},
+	}
+	for _, test := range tests {
+		// map order must not matter
+		for i := 0; i < 20; i++ {
+			htmlstr, _ := Fill([]byte(src), formData, test.options)
+			if string(htmlstr) != test.success {
+				t.Errorf("password options %v error: %v", test.options, string(htmlstr))
+				break
+			}
+		}
+	}
+}
+
+func TestMissingPolicy(t *testing.T) {
+	formData := map[string][]string{
+		"title": []string{""},
+		"tel":   []string{"03"},
+	}
+	src := `<form><input type="hidden" name=".site_token" value="t0"><input name="title" value="default"><input name="tel" value="x"><input name="tel" value="y">
+<input type="radio" name="rdo" value="1" checked><input type="radio" name="rdo" value="2">
+<select name="pref"><option>1</option><option selected>2</option></select><textarea name="body">hello</textarea></form>`
+
+	tests := []struct {
+		opts []Option
+		want string
+	}{
+		{[]Option{WithFillHidden(".site_token")}, `<form><input type="hidden" name=".site_token" value=""><input name="title" value=""><input name="tel" value="03"><input name="tel" value="">
+<input type="radio" name="rdo" value="1"><input type="radio" name="rdo" value="2">
+<select name="pref"><option>1</option><option>2</option></select><textarea name="body"></textarea></form>`},
+		{[]Option{WithFillHidden(".site_token"), WithMissing(MissingPreserve)}, `<form><input type="hidden" name=".site_token" value="t0"><input name="title" value="default"><input name="tel" value="03"><input name="tel" value="y">
+<input type="radio" name="rdo" value="1" checked><input type="radio" name="rdo" value="2">
+<select name="pref"><option>1</option><option selected>2</option></select><textarea name="body">hello</textarea></form>`},
+		{[]Option{WithFillHidden(".site_token"), WithMissing(MissingPresentOnly)}, `<form><input type="hidden" name=".site_token" value="t0"><input name="title" value=""><input name="tel" value="03"><input name="tel" value="y">
+<input type="radio" name="rdo" value="1" checked><input type="radio" name="rdo" value="2">
+<select name="pref"><option>1</option><option selected>2</option></select><textarea name="body">hello</textarea></form>`},
+		{[]Option{WithFillHidden(".site_token"), WithMissing(MissingPreserve, "hidden", "radio")}, `<form><input type="hidden" name=".site_token" value="t0"><input name="title" value=""><input name="tel" value="03"><input name="tel" value="">
+<input type="radio" name="rdo" value="1" checked><input type="radio" name="rdo" value="2">
+<select name="pref"><option>1</option><option>2</option></select><textarea name="body"></textarea></form>`},
+		{[]Option{WithOptions(map[string]interface{}{
+			"FillHidden":   []string{".site_token"},
+			"Missing":      MissingPresentOnly,
+			"MissingTypes": map[string]MissingPolicy{"textarea": MissingClear},
+		})}, `<form><input type="hidden" name=".site_token" value="t0"><input name="title" value=""><input name="tel" value="03"><input name="tel" value="y">
+<input type="radio" name="rdo" value="1" checked><input type="radio" name="rdo" value="2">
+<select name="pref"><option>1</option><option selected>2</option></select><textarea name="body"></textarea></form>`},
+	}
+	for i, test := range tests {
+		filler, err := NewFiller(test.opts...)
+		if err != nil {
+			t.Fatalf("new filler error: %v", err)
+		}
+		htmlstr, _ := filler.Fill([]byte(src), formData)
+		if string(htmlstr) != test.want {
+			t.Errorf("missing policy %d error: %v", i, string(htmlstr))
+		}
+	}
+
+	if _, err := NewFiller(WithMissing(MissingPolicy(9))); err == nil {
+		t.Errorf("unknown policy should fail")
+	}
+}
+
+func TestTargetOptions(t *testing.T) {
+	formData := map[string][]string{"q": []string{"hoge"}}
+	src := `<form id="a"><input name="q"></form><form name="login"><input name="q"></form><form action="/search?x=1&amp;y=2"><input name="q"></form><form><input name="q"></form>`
+
+	tests := []struct {
+		opts    []Option
+		success string
+	}{
+		{[]Option{WithTarget("a")}, `<form id="a"><input name="q" value="hoge"></form><form name="login"><input name="q" value="hoge"></form><form action="/search?x=1&amp;y=2"><input name="q" value="hoge"></form><form><input name="q" value="hoge"></form>`},
+		{[]Option{WithTarget("b"), WithStrictTarget(true)}, `<form id="a"><input name="q"></form><form name="login"><input name="q"></form><form action="/search?x=1&amp;y=2"><input name="q"></form><form><input name="q"></form>`},
+		{[]Option{WithTargetIDs("b", "a"), WithStrictTarget(true)}, `<form id="a"><input name="q" value="hoge"></form><form name="login"><input name="q"></form><form action="/search?x=1&amp;y=2"><input name="q"></form><form><input name="q"></form>`},
+		{[]Option{WithTargetNames("login"), WithTargetActions("/search?x=1&y=2")}, `<form id="a"><input name="q" value="hoge"></form><form name="login"><input name="q" value="hoge"></form><form action="/search?x=1&amp;y=2"><input name="q" value="hoge"></form><form><input name="q" value="hoge"></form>`},
+		{[]Option{WithTargetNames("login"), WithStrictTarget(true)}, `<form id="a"><input name="q"></form><form name="login"><input name="q" value="hoge"></form><form action="/search?x=1&amp;y=2"><input name="q"></form><form><input name="q"></form>`},
+		{[]Option{WithTargetFunc(func(attrs map[string]string) bool { return attrs["action"] == "/search?x=1&y=2" })}, `<form id="a"><input name="q"></form><form name="login"><input name="q"></form><form action="/search?x=1&amp;y=2"><input name="q" value="hoge"></form><form><input name="q"></form>`},
+	}
+	for _, test := range tests {
+		filler, err := NewFiller(test.opts...)
+		if err != nil {
+			t.Fatalf("new filler error: %v", err)
+		}
+		htmlstr, _ := filler.Fill([]byte(src), formData)
+		if string(htmlstr) != test.success {
+			t.Errorf("target error: %v", string(htmlstr))
+		}
+	}
+
+	htmlstr, err := Fill([]byte(src), formData, map[string]interface{}{"TargetIDs": []string{"a"}, "StrictTarget": true})
+	if err != nil || string(htmlstr) != `<form id="a"><input name="q" value="hoge"></form><form name="login"><input name="q"></form><form action="/search?x=1&amp;y=2"><input name="q"></form><form><input name="q"></form>` {
+		t.Errorf("target map options error: %v %v", string(htmlstr), err)
+	}
+}
+
+func TestPatternOptions(t *testing.T) {
+	formData := map[string][]string{
+		"card_number": []string{"4111"},
+		"card_cvc":    []string{"123"},
+		"api_token":   []string{"x"},
+		"secret.key":  []string{"k"},
+		"secretary":   []string{"s"},
+		"title":       []string{"hoge"},
+		"tel":         []string{"03"},
+	}
+	src := `<form><input name="card_number"><input name="card_cvc"><input name="api_token"><input name="secret.key"><input name="secretary"><input name="title"><input type="TEL" name="tel"></form>`
+
+	tests := []struct {
+		opts    []Option
+		success string
+	}{
+		{[]Option{WithIgnoreFieldGlobs("card_*", "*_token")}, `<form><input name="card_number"><input name="card_cvc"><input name="api_token"><input name="secret.key" value="k"><input name="secretary" value="s"><input name="title" value="hoge"><input type="TEL" name="tel" value="03"></form>`},
+		{[]Option{WithIgnoreFieldRegexps(`^secret\.`)}, `<form><input name="card_number" value="4111"><input name="card_cvc" value="123"><input name="api_token" value="x"><input name="secret.key"><input name="secretary" value="s"><input name="title" value="hoge"><input type="TEL" name="tel" value="03"></form>`},
+		{[]Option{WithIgnoreTypeGlobs("t?l")}, `<form><input name="card_number" value="4111"><input name="card_cvc" value="123"><input name="api_token" value="x"><input name="secret.key" value="k"><input name="secretary" value="s"><input name="title" value="hoge"><input type="TEL" name="tel"></form>`},
+		{[]Option{WithIgnoreTypeRegexps(`^(tel|email)$`)}, `<form><input name="card_number" value="4111"><input name="card_cvc" value="123"><input name="api_token" value="x"><input name="secret.key" value="k"><input name="secretary" value="s"><input name="title" value="hoge"><input type="TEL" name="tel"></form>`},
+		{[]Option{WithFillOnlyGlobs("card_*", "title"), WithIgnoreFields("card_cvc")}, `<form><input name="card_number" value="4111"><input name="card_cvc"><input name="api_token"><input name="secret.key"><input name="secretary"><input name="title" value="hoge"><input type="TEL" name="tel"></form>`},
+		{[]Option{WithFillOnlyRegexps(`^t`)}, `<form><input name="card_number"><input name="card_cvc"><input name="api_token"><input name="secret.key"><input name="secretary"><input name="title" value="hoge"><input type="TEL" name="tel" value="03"></form>`},
+	}
+	for _, test := range tests {
+		filler, err := NewFiller(test.opts...)
+		if err != nil {
+			t.Fatalf("new filler error: %v", err)
+		}
+		htmlstr, _ := filler.Fill([]byte(src), formData)
+		if string(htmlstr) != test.success {
+			t.Errorf("pattern error: %v", string(htmlstr))
+		}
+	}
+
+	htmlstr, err := Fill([]byte(src), formData, map[string]interface{}{"IgnoreFieldGlobs": []string{"*"}})
+	if err != nil || string(htmlstr) != src {
+		t.Errorf("pattern map options error: %v %v", string(htmlstr), err)
+	}
+	if _, err := NewFiller(WithIgnoreFieldRegexps("(")); err == nil {
+		t.Errorf("bad regexp should fail")
+	} else if oerr, ok := err.(*OptionError); !ok || oerr.Key != "IgnoreFieldRegexps" {
+		t.Errorf("bad regexp error: %v", err)
+	}
+}
@@ -0,0 +1,396 @@
+package fillinform
+
+import (
+	"bytes"
+	"html"
+	"unicode/utf8"
+)
+
+// control kinds
+const (
+	controlInput = iota
+	controlSelect
+	controlTextarea
+)
+
+// Plan is a compiled html document. It records the offsets and attributes of
+// every fillable control, so the same document can be filled again and again
+// without being scanned. A Plan is never modified after Compile and may be
+// shared and cached, e.g. per template name.
+type Plan struct {
+	src      []byte
+	forms    []planForm
+	controls []control // in document order
+}
+
+type planForm struct {
+	tag        tag // start tag
+	inTemplate bool
+}
+
+// control is a fillable control. Offsets are relative to Plan.src.
+type control struct {
+	kind        int
+	tag         tag // start tag
+	name        []byte
+	hasName     bool
+	form        int    // index of the form element it is in, or -1
+	formAttr    []byte // the form attribute, the id of the owning form
+	hasFormAttr bool
+	inTemplate  bool     // inside a template element
+	inputType   string   // input: the type, normalized
+	typeAttr    string   // input: the type attribute in lower case
+	value       []byte   // input: the value attribute, decoded
+	end         int      // just past the tag, </select> or </textarea>
+	content     int      // textarea: start of </textarea>
+	options     []option // select
+}
+
+type option struct {
+	tag   tag    // start tag
+	end   int    // just past </option>, or where the option is implicitly closed
+	value []byte // decoded
+}
+
+// Compile scans html once and returns a Plan for filling it.
+// html is copied, so the caller may reuse it.
+func Compile(html []byte) (*Plan, error) {
+	p, err := compile(append([]byte(nil), html...))
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Fill returns the document of p with its forms filled with data.
+func (p *Plan) Fill(data map[string][]string, options map[string]interface{}) ([]byte, error) {
+	filler, err := NewFiller(WithOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	return filler.FillPlan(p, data)
+}
+
+// compile builds the plan of b without copying it. A malformed part of b is
+// left out of the plan and reported by the first *ParseError, but the plan is
+// usable even then.
+func compile(b []byte) (*Plan, error) {
+	p := &Plan{src: b}
+	return p, p.compileRegion(b, 0, false)
+}
+
+// prefix returns the plan of p.src[:n], where n is not inside a form or a
+// control of p.
+func (p *Plan) prefix(n int) *Plan {
+	q := &Plan{src: p.src[:n], forms: p.forms, controls: p.controls}
+	for len(q.forms) > 0 && q.forms[len(q.forms)-1].tag.start >= n {
+		q.forms = q.forms[:len(q.forms)-1]
+	}
+	for len(q.controls) > 0 && q.controls[len(q.controls)-1].tag.start >= n {
+		q.controls = q.controls[:len(q.controls)-1]
+	}
+	return q
+}
+
+// compileRegion adds the forms and controls in b[i:] to p. Comments and raw
+// text elements are skipped.
+func (p *Plan) compileRegion(b []byte, i int, inTemplate bool) error {
+	var err error
+	for i < len(b) {
+		j := bytes.IndexByte(b[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j
+		if end, ok, _ := skipComment(b, i); ok {
+			i = end
+			continue
+		}
+		t, state := parseTag(b, i, false)
+		if state != tagOK {
+			i++
+			continue
+		}
+		i = t.end
+		switch {
+		case t.closing:
+		case t.is(_Form):
+			end, ferr := p.compileForm(b, t, inTemplate)
+			if err == nil {
+				err = ferr
+			}
+			i = end
+		case t.is(_Template):
+			content, end := findElementEnd(b, t.end, _Template)
+			if end < 0 {
+				// the template runs to the end
+				content, end = len(b), len(b)
+			}
+			if terr := p.compileRegion(b[:content], t.end, true); err == nil {
+				err = terr
+			}
+			i = end
+		default:
+			// controls outside of forms, malformed ones are left as text
+			if c, ok, _ := compileControl(b, t); ok {
+				c.form = -1
+				c.inTemplate = inTemplate
+				p.controls = append(p.controls, c)
+				i = c.end
+			} else if raw := rawText(&t); raw != "" {
+				if _, i = findEndTag(b, t.end, raw); i < 0 {
+					i = len(b)
+				}
+			}
+		}
+	}
+	return err
+}
+
+// compileForm adds the form started by t and its controls to p, and returns
+// the offset just past the form.
+func (p *Plan) compileForm(b []byte, t tag, inTemplate bool) (int, error) {
+	_, end := findElementEnd(b, t.end, _Form)
+	if end < 0 {
+		// an unterminated element in the form may hide its end tag
+		if _, end = findEndTag(b, t.end, _Form); end < 0 {
+			return len(b), newParseError(b, t.start, "form is not terminated")
+		}
+	}
+	b = b[:end]
+	form := len(p.forms)
+	p.forms = append(p.forms, planForm{inTemplate: inTemplate})
+	p.forms[form].tag, _ = parseTag(b, t.start, true)
+
+	var err error
+	templates := 0
+	for i := t.end; i < len(b); {
+		j := bytes.IndexByte(b[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j
+		if end, ok, _ := skipComment(b, i); ok {
+			i = end
+			continue
+		}
+		t, state := parseTag(b, i, false)
+		if state != tagOK {
+			if state == tagPartial && err == nil {
+				err = newParseError(b, i, "tag is not terminated")
+			}
+			i++
+			continue
+		}
+		i = t.end
+		c, ok, cerr := compileControl(b, t)
+		if cerr != nil && err == nil {
+			err = cerr
+		}
+		switch {
+		case ok:
+			c.form = form
+			c.inTemplate = inTemplate || templates > 0
+			p.controls = append(p.controls, c)
+			i = c.end
+		case rawText(&t) != "" && !t.is(_Textarea):
+			if _, i = findEndTag(b, t.end, rawText(&t)); i < 0 {
+				if err == nil {
+					err = newParseError(b, t.start, rawText(&t)+" is not terminated")
+				}
+				i = len(b)
+			}
+		case t.is(_Template) && !t.closing:
+			templates++
+		case t.is(_Template) && templates > 0:
+			templates--
+		}
+	}
+	return end, err
+}
+
+// compileControl returns the control started by t, if t starts one.
+func compileControl(b []byte, t tag) (control, bool, error) {
+	var c control
+	if t.closing {
+		return c, false, nil
+	}
+	switch {
+	case t.is(_Input):
+		c.kind = controlInput
+		c.end = t.end
+	case t.is(_Select):
+		c.kind = controlSelect
+		if _, c.end = findElementEnd(b, t.end, _Select); c.end < 0 {
+			return c, false, newParseError(b, t.start, "select is not terminated")
+		}
+		c.options = compileOptions(b[:c.end], t.end)
+	case t.is(_Textarea):
+		c.kind = controlTextarea
+		if c.content, c.end = findEndTag(b, t.end, _Textarea); c.end < 0 {
+			return c, false, newParseError(b, t.start, "textarea is not terminated")
+		}
+	default:
+		return c, false, nil
+	}
+	c.tag, _ = parseTag(b, t.start, true)
+	c.name, c.hasName = c.tag.get(_Name)
+	c.formAttr, c.hasFormAttr = c.tag.get(_Form)
+	if c.kind == controlInput {
+		typ, _ := c.tag.get(_Type)
+		c.typeAttr = string(bytes.ToLower(typ))
+		c.inputType = normalizeInputType(typ)
+		value, _ := c.tag.get(_Value)
+		c.value = decodeEntity(value)
+	}
+	return c, true, nil
+}
+
+// inputTypes are the values of the type attribute of input elements.
+var inputTypes = map[string]bool{
+	"hidden": true, "text": true, "search": true, "tel": true, "url": true,
+	"email": true, "password": true, "date": true, "month": true, "week": true,
+	"time": true, "datetime-local": true, "number": true, "range": true,
+	"color": true, "checkbox": true, "radio": true, "file": true,
+	"submit": true, "image": true, "reset": true, "button": true,
+}
+
+// normalizeInputType returns the type of an input with the type attribute
+// typ. As the type attribute is case-insensitive, and a missing or unknown
+// type means text, <INPUT TYPE="Checkbox"> is a "checkbox".
+func normalizeInputType(typ []byte) string {
+	s := string(bytes.ToLower(typ))
+	if !inputTypes[s] {
+		return "text"
+	}
+	return s
+}
+
+// compileOptions collects the options in b starting at b[i].
+func compileOptions(b []byte, i int) []option {
+	var options []option
+	for {
+		t, ok := nextTag(b, i)
+		if !ok {
+			return options
+		}
+		i = t.end
+		if t.closing || !t.is(_Option) {
+			continue
+		}
+		o := option{end: optionEnd(b, t.end)}
+		o.tag, _ = parseTag(b, t.start, true)
+		if value, found := o.tag.get(_Value); found {
+			o.value = decodeEntity(value)
+		} else {
+			end, _ := findEndTag(b[:o.end], t.end, _Option)
+			if end < 0 {
+				end = o.end
+			}
+			o.value = collapseSpace(decodeEntity(b[t.end:end]))
+		}
+		options = append(options, o)
+		i = o.end
+	}
+}
+
+// decodeEntity decodes the character references in b, named and numeric,
+// so R&amp;D is compared as R&D.
+func decodeEntity(b []byte) []byte {
+	if bytes.IndexByte(b, '&') < 0 {
+		return b
+	}
+	return []byte(html.UnescapeString(string(b)))
+}
+
+// collapseSpace strips and collapses the white space in the text of an
+// option, no-break spaces included, so "&nbsp;Tokyo " is Tokyo.
+func collapseSpace(b []byte) []byte {
+	fields := bytes.FieldsFunc(b, func(r rune) bool {
+		return r == '\u00a0' || r < utf8.RuneSelf && isSpace(byte(r))
+	})
+	if len(fields) == 1 && len(fields[0]) == len(b) {
+		return b
+	}
+	return bytes.Join(fields, []byte{' '})
+}
+
+// optionEnd returns the offset just past </option>, or the start of the tag
+// that implicitly closes the option started before b[i].
+func optionEnd(b []byte, i int) int {
+	for {
+		t, ok := nextTag(b, i)
+		if !ok {
+			return len(b)
+		}
+		switch {
+		case t.is(_Option) && t.closing:
+			return t.end
+		case t.is(_Option), t.is(_Optgroup), t.is(_Select) && t.closing:
+			return t.start
+		}
+		i = t.end
+	}
+}
+
+// fillPlan splices the values into the controls recorded in p.
+func (f *fillState) fillPlan(p *Plan) []byte {
+	forms := make([]*formState, len(p.forms))
+	for i := range p.forms {
+		form := &p.forms[i]
+		forms[i] = f.newFormState(&form.tag, form.inTemplate)
+		// the first form of an id owns the controls naming it, as by
+		// getElementById; forms in templates are not in the document
+		if id := forms[i].id; id != "" && !form.inTemplate {
+			if _, dup := f.formsByID[id]; !dup {
+				f.formsByID[id] = forms[i]
+			}
+		}
+	}
+
+	src := p.src
+	out := make([]byte, 0, len(src)+len(src)/16)
+	last := 0
+	for i := range p.controls {
+		c := &p.controls[i]
+		if f.aborted {
+			break
+		}
+		form := f.owner(c, forms)
+		if form == nil || form.skip || c.inTemplate && !f.opts.FillTemplates {
+			continue
+		}
+		f.cur = form
+		out = append(out, src[last:c.tag.start]...)
+		switch c.kind {
+		case controlInput:
+			out = append(out, f.fillInput(src, c)...)
+		case controlSelect:
+			out = append(out, f.fillSelect(src, c)...)
+		case controlTextarea:
+			out = append(out, f.fillTextarea(src, c)...)
+		}
+		last = c.end
+	}
+	return append(out, src[last:]...)
+}
+
+// owner returns the state of the form owning c: the form its form attribute
+// names, or else the form element it is in. Controls without an owner are
+// filled only with the FillOutside option, nil is returned otherwise.
+func (f *fillState) owner(c *control, forms []*formState) *formState {
+	var form *formState
+	switch {
+	case c.hasFormAttr:
+		form = f.formsByID[string(decodeEntity(c.formAttr))]
+	case c.form >= 0:
+		form = forms[c.form]
+	}
+	if form == nil && f.opts.FillOutside {
+		if f.outside == nil {
+			f.outside = f.newFormState(nil, false)
+		}
+		form = f.outside
+	}
+	return form
+}
@@ -0,0 +1,45 @@
+package fillinform
+
+import (
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	src := []byte(HTMLBig)
+	plan, err := Compile(src)
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	// the plan keeps its own copy
+	copy(src, "xxxxxxxxxx")
+
+	for i := 0; i < 2; i++ {
+		if htmlstr, _ := plan.Fill(writerFormData, nil); string(htmlstr) != HTMLBigSuccess {
+			t.Errorf("plan fill error: %s", string(htmlstr))
+		}
+	}
+	if htmlstr, _ := plan.Fill(nil, map[string]interface{}{"Target": "other"}); string(htmlstr) != HTMLBig {
+		t.Errorf("plan target error: %s", string(htmlstr))
+	}
+
+	plan, err = Compile([]byte(`<form id="a"><input name="x"></form>`))
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	if len(plan.forms) != 1 || len(plan.controls) != 1 || plan.controls[0].form != 0 {
+		t.Errorf("compile controls error: %+v", plan.controls)
+	}
+
+	if _, err := Compile([]byte(`<p></p><form id="a"><input name="x">`)); err == nil {
+		t.Errorf("unterminated form should fail")
+	}
+}
+
+func BenchmarkPlanBigHTML(b *testing.B) {
+	plan, _ := Compile([]byte(HTMLBig))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		plan.Fill(writerFormData, nil)
+	}
+}
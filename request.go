@@ -0,0 +1,46 @@
+package fillinform
+
+import (
+	"net/http"
+)
+
+const _Method = `method`
+
+// maxMemory is the memory used to parse a multipart request, as by
+// http.Request.FormValue.
+const maxMemory = 32 << 20
+
+// FillRequest fills body with the values submitted in r.
+// Forms with method="post" are filled from r.PostForm, multipart values
+// included, all other forms from the query string of r.URL, so a search box
+// and a posted form on the same page each keep their own values. Controls
+// outside of forms take the posted values first.
+func FillRequest(body []byte, r *http.Request, options map[string]interface{}) ([]byte, error) {
+	filler, err := NewFiller(WithOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	return filler.FillRequest(body, r)
+}
+
+// FillRequest fills body with the values submitted in r, as the package
+// level FillRequest does.
+func (f *Filler) FillRequest(body []byte, r *http.Request) ([]byte, error) {
+	if err := r.ParseMultipartForm(maxMemory); err != nil && err != http.ErrNotMultipart {
+		return nil, err
+	}
+	post := URLValues(r.PostForm)
+	get := URLValues(r.URL.Query())
+	s := f.newSourceState(nil)
+	s.dataFor = func(formTag *tag) DataSource {
+		if formTag == nil {
+			// controls outside of forms, e.g. in a fragment
+			return Layers{post, get}
+		}
+		if method, _ := formTag.get(_Method); equalFold(method, "post") {
+			return post
+		}
+		return get
+	}
+	return s.fill(body)
+}
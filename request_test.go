@@ -0,0 +1,62 @@
+package fillinform
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var HTMLRequest = `<form action="/search"><input name="q"></form>
+<form action="/post" method="POST"><input name="q"><textarea name="body"></textarea></form>`
+
+func TestFillRequest(t *testing.T) {
+	r := httptest.NewRequest("POST", "/post?q=search", strings.NewReader("q=posted&body=hoge"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	htmlstr, err := FillRequest([]byte(HTMLRequest), r, nil)
+	if err != nil {
+		t.Fatalf("fill request error: %v", err)
+	}
+	if string(htmlstr) != `<form action="/search"><input name="q" value="search"></form>
+<form action="/post" method="POST"><input name="q" value="posted"><textarea name="body">hoge</textarea></form>` {
+		t.Errorf("fill request error: %v", string(htmlstr))
+	}
+
+	r = httptest.NewRequest("GET", "/search?q=search", nil)
+	htmlstr, _ = FillRequest([]byte(HTMLRequest), r, nil)
+	if string(htmlstr) != `<form action="/search"><input name="q" value="search"></form>
+<form action="/post" method="POST"><input name="q" value=""><textarea name="body"></textarea></form>` {
+		t.Errorf("fill request error: %v", string(htmlstr))
+	}
+}
+
+func TestFillRequestOutside(t *testing.T) {
+	r := httptest.NewRequest("POST", "/post?q=search&page=2", strings.NewReader("q=posted"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	filler, _ := NewFiller(WithFillOutside(true))
+	htmlstr, _ := filler.FillRequest([]byte(`<input name="q"><input name="page">`), r)
+	if string(htmlstr) != `<input name="q" value="posted"><input name="page" value="2">` {
+		t.Errorf("fill request outside error: %v", string(htmlstr))
+	}
+}
+
+func TestFillRequestMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("q", "posted")
+	mw.WriteField("body", "hoge")
+	mw.Close()
+	r := httptest.NewRequest("POST", "/post", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	filler, _ := NewFiller(WithIgnoreFields("body"))
+	htmlstr, err := filler.FillRequest([]byte(HTMLRequest), r)
+	if err != nil {
+		t.Fatalf("fill request error: %v", err)
+	}
+	if string(htmlstr) != `<form action="/search"><input name="q" value=""></form>
+<form action="/post" method="POST"><input name="q" value="posted"><textarea name="body"></textarea></form>` {
+		t.Errorf("fill request error: %v", string(htmlstr))
+	}
+}
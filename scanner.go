@@ -0,0 +1,477 @@
+package fillinform
+
+import (
+	"bytes"
+)
+
+// results of parseTag
+const (
+	tagNone    = iota // not a tag
+	tagPartial        // may be a tag, but the input ends before '>'
+	tagOK
+)
+
+// tag is a start or end tag found in an html document.
+// Offsets are relative to the slice given to parseTag.
+type tag struct {
+	name        []byte
+	attrs       []attr
+	start, end  int // offsets of '<' and just past '>'
+	attrEnd     int // offset just past the last attribute (or the tag name)
+	closing     bool
+	selfClosing bool
+}
+
+// attr is an attribute of a tag. start points at the white space in front of
+// the attribute name, end just past the value, or the name of an attribute
+// without value. A later attribute of the same name is kept but ignored by
+// get, as browsers do.
+type attr struct {
+	name       []byte
+	value      []byte
+	start, end int
+	nameStart  int
+}
+
+// unquote strips the pair of quotes around an attribute value.
+func unquote(tag []byte) []byte {
+	if n := len(tag); n >= 2 && (tag[0] == '"' || tag[0] == '\'') && tag[n-1] == tag[0] {
+		return tag[1 : n-1]
+	}
+	return tag
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isTagNameByte(c byte) bool {
+	return isLetter(c) || '0' <= c && c <= '9'
+}
+
+// isAttrNameByte reports whether c may be part of an attribute name, which is
+// anything but white space, quotes, '<', '>', '/' and '=', so names like
+// data-x, v-bind:value, @click or x.y are read whole.
+func isAttrNameByte(c byte) bool {
+	return c > ' ' && c != 0x7f && c != '"' && c != '\'' && c != '<' && c != '>' && c != '/' && c != '='
+}
+
+// equalFold reports whether b equals the lower case ASCII string s, ignoring case.
+func equalFold(b []byte, s string) bool {
+	if len(b) != len(s) {
+		return false
+	}
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != s[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTag parses the tag starting at b[i], which must be '<'.
+// Attributes are collected only when withAttrs is set.
+func parseTag(b []byte, i int, withAttrs bool) (t tag, state int) {
+	t.start = i
+	p := i + 1
+	if p < len(b) && b[p] == '/' {
+		t.closing = true
+		p++
+	}
+	ns := p
+	for p < len(b) && (isLetter(b[p]) || p > ns && isTagNameByte(b[p])) {
+		p++
+	}
+	if p == len(b) {
+		return t, tagPartial
+	}
+	if p == ns {
+		return t, tagNone
+	}
+	t.name = b[ns:p]
+	t.attrEnd = p
+	if withAttrs {
+		t.attrs = make([]attr, 0, 8)
+	}
+	if !isSpace(b[p]) && b[p] != '>' && b[p] != '/' {
+		return t, tagNone
+	}
+
+	quoted := false
+	for {
+		ws := p
+		for p < len(b) && isSpace(b[p]) {
+			p++
+		}
+		if p == len(b) {
+			return t, tagPartial
+		}
+		switch b[p] {
+		case '>':
+			t.end = p + 1
+			return t, tagOK
+		case '/':
+			if p+1 == len(b) {
+				return t, tagPartial
+			}
+			if b[p+1] != '>' {
+				return t, tagNone
+			}
+			t.selfClosing = true
+			t.end = p + 2
+			return t, tagOK
+		}
+		// attributes are separated by white space, except after a quoted
+		// value; end tags have none
+		if p == ws && !quoted || t.closing {
+			return t, tagNone
+		}
+
+		a := attr{start: ws, nameStart: p}
+		for p < len(b) && isAttrNameByte(b[p]) {
+			p++
+		}
+		if p == len(b) {
+			return t, tagPartial
+		}
+		if p == a.nameStart {
+			return t, tagNone
+		}
+		a.name = b[a.nameStart:p]
+		a.end = p
+		quoted = false
+
+		// the value, with optional white space around '='
+		q := p
+		for q < len(b) && isSpace(b[q]) {
+			q++
+		}
+		if q == len(b) {
+			return t, tagPartial
+		}
+		if b[q] == '=' {
+			q++
+			for q < len(b) && isSpace(b[q]) {
+				q++
+			}
+			if q == len(b) {
+				return t, tagPartial
+			}
+			vs := q
+			switch c := b[q]; c {
+			case '"', '\'':
+				n := bytes.IndexByte(b[q+1:], c)
+				if n < 0 {
+					return t, tagPartial
+				}
+				q += n + 2
+				quoted = true
+			default:
+				for q < len(b) && !isSpace(b[q]) && b[q] != '>' && b[q] != '"' && b[q] != '\'' &&
+					!(b[q] == '/' && (q+1 == len(b) || b[q+1] == '>')) {
+					q++
+				}
+				if q == len(b) {
+					return t, tagPartial
+				}
+				if q == vs {
+					return t, tagNone
+				}
+			}
+			a.value = unquote(b[vs:q])
+			p = q
+			a.end = p
+		}
+		t.attrEnd = p
+		if withAttrs {
+			t.attrs = append(t.attrs, a)
+		}
+	}
+}
+
+// rawTextElements hold text rather than markup (textarea and title hold
+// escapable text), so tags in their content are not tags.
+var rawTextElements = []string{`script`, `style`, _Textarea, `title`, `xmp`, `iframe`, `noembed`, `noframes`}
+
+// rawText returns the name of the raw text element t starts, or "".
+func rawText(t *tag) string {
+	if t.closing {
+		return ""
+	}
+	for _, name := range rawTextElements {
+		if t.is(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// skipComment reports whether b[i] starts a comment, a doctype or another
+// markup declaration, or a processing instruction, and returns the offset
+// just past it. complete is false when it runs to the end of b.
+func skipComment(b []byte, i int) (end int, ok, complete bool) {
+	if i+1 == len(b) {
+		return 0, false, false
+	}
+	switch b[i+1] {
+	case '!':
+		if bytes.HasPrefix(b[i:], []byte(`<!--`)) {
+			// <!--> and <!---> are empty comments
+			if n := bytes.Index(b[i+2:], []byte(`-->`)); n >= 0 {
+				return i + 2 + n + 3, true, true
+			}
+			return len(b), true, false
+		}
+		if bytes.HasPrefix([]byte(`<!--`), b[i:]) {
+			return len(b), true, false
+		}
+	case '?':
+	default:
+		return 0, false, false
+	}
+	if n := bytes.IndexByte(b[i+2:], '>'); n >= 0 {
+		return i + 2 + n + 1, true, true
+	}
+	return len(b), true, false
+}
+
+// nextTag returns the first tag at or after b[i], outside of comments.
+func nextTag(b []byte, i int) (tag, bool) {
+	for i < len(b) {
+		j := bytes.IndexByte(b[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j
+		if end, ok, _ := skipComment(b, i); ok {
+			i = end
+			continue
+		}
+		if t, state := parseTag(b, i, false); state == tagOK {
+			return t, true
+		}
+		i++
+	}
+	return tag{}, false
+}
+
+// findEndTag returns the offsets of the first </name> at or after b[i],
+// or -1, -1 if there is none. Everything up to it is taken as text, as in
+// raw text elements.
+func findEndTag(b []byte, i int, name string) (int, int) {
+	start, end, _ := scanEndTag(b, i, name)
+	return start, end
+}
+
+// scanEndTag is findEndTag that, when there is no end tag, also returns the
+// offset to resume the search from once more of the document is known.
+func scanEndTag(b []byte, i int, name string) (start, end, next int) {
+	for i < len(b) {
+		j := bytes.Index(b[i:], []byte(`</`))
+		if j < 0 {
+			break
+		}
+		i += j
+		t, state := parseTag(b, i, false)
+		if state == tagOK && equalFold(t.name, name) {
+			return t.start, t.end, i
+		}
+		if state == tagPartial {
+			return -1, -1, i
+		}
+		i += 2
+	}
+	// a '<' at the end may start the end tag
+	if n := len(b) - 1; i < n {
+		i = n
+	}
+	return -1, -1, i
+}
+
+// findElementEnd returns the offsets of the end tag of the name element
+// whose content starts at b[i], or -1, -1 if there is none. Comments and raw
+// text elements are skipped and nested templates are counted.
+func findElementEnd(b []byte, i int, name string) (int, int) {
+	start, end, _, _ := scanElement(b, i, name, 0)
+	return start, end
+}
+
+// scanElement is findElementEnd starting with depth nested templates open.
+// When there is no end tag, it also returns the offset to resume the search
+// from once more of the document is known, and the depth there.
+func scanElement(b []byte, i int, name string, depth int) (start, end, next, nextDepth int) {
+	for i < len(b) {
+		j := bytes.IndexByte(b[i:], '<')
+		if j < 0 {
+			i = len(b)
+			break
+		}
+		i += j
+		if end, ok, complete := skipComment(b, i); ok {
+			if !complete {
+				break
+			}
+			i = end
+			continue
+		}
+		t, state := parseTag(b, i, false)
+		if state == tagPartial {
+			break
+		}
+		if state != tagOK {
+			i++
+			continue
+		}
+		switch {
+		case rawText(&t) != "":
+			_, e := findEndTag(b, t.end, rawText(&t))
+			if e < 0 {
+				return -1, -1, t.start, depth
+			}
+			i = e
+			continue
+		case !t.is(name):
+		case !t.closing:
+			if name == _Template {
+				depth++
+			}
+		case depth > 0:
+			depth--
+		default:
+			return t.start, t.end, t.end, depth
+		}
+		i = t.end
+	}
+	return -1, -1, i, depth
+}
+
+// findForm looks for the first form, or template, at or after b[i] and
+// returns the offsets of its start tag and just past its end tag. Comments,
+// raw text elements and selects are skipped. complete is false when the
+// element, or a comment, raw text element, select or tag, runs to the end of
+// b; start is then where it begins.
+// start is -1 when there is no form at all.
+func findForm(b []byte, i int) (start, end int, complete bool) {
+	for i < len(b) {
+		j := bytes.IndexByte(b[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j
+		if end, ok, complete := skipComment(b, i); ok {
+			if !complete {
+				return i, -1, false
+			}
+			i = end
+			continue
+		}
+		t, state := parseTag(b, i, false)
+		switch state {
+		case tagNone:
+			i++
+			continue
+		case tagPartial:
+			// may become a control outside of forms as well
+			return i, -1, false
+		}
+		if raw := rawText(&t); raw != "" {
+			if _, e := findEndTag(b, t.end, raw); e >= 0 {
+				i = e
+				continue
+			}
+			return i, -1, false
+		}
+		if t.closing || !t.is(_Form) && !t.is(_Template) && !t.is(_Select) {
+			i = t.end
+			continue
+		}
+		name := _Form
+		switch {
+		case t.is(_Template):
+			name = _Template
+		case t.is(_Select):
+			if _, e := findElementEnd(b, t.end, _Select); e >= 0 {
+				i = e
+				continue
+			}
+			return i, -1, false
+		}
+		if _, e := findElementEnd(b, t.end, name); e >= 0 {
+			return i, e, true
+		}
+		return i, -1, false
+	}
+	return -1, -1, false
+}
+
+// get returns the value of the first attribute named name.
+func (t *tag) get(name string) ([]byte, bool) {
+	for i := range t.attrs {
+		if equalFold(t.attrs[i].name, name) {
+			return t.attrs[i].value, true
+		}
+	}
+	return nil, false
+}
+
+// is reports whether t is named name.
+func (t *tag) is(name string) bool {
+	return equalFold(t.name, name)
+}
+
+// rewrite returns the bytes of t, taken from b, with every attribute named
+// drop removed, the first attribute named set replaced by set="value" (or
+// appended when missing), and add appended to the end of the tag.
+// Empty arguments are ignored.
+func (t *tag) rewrite(b []byte, drop, set string, value, add []byte) []byte {
+	if set == "" && len(add) == 0 {
+		if _, ok := t.get(drop); !ok {
+			return b[t.start:t.end:t.end]
+		}
+	}
+	out := make([]byte, 0, t.end-t.start+len(set)+len(value)+len(add)+4)
+	last := t.start
+	replaced := false
+	for _, a := range t.attrs {
+		switch {
+		case drop != "" && equalFold(a.name, drop):
+			out = append(out, b[last:a.start]...)
+			last = a.end
+		case set != "" && !replaced && equalFold(a.name, set):
+			replaced = true
+			out = append(out, b[last:a.nameStart]...)
+			out = appendAttr(out, set, value)
+			last = a.end
+		}
+	}
+	if set != "" && !replaced {
+		add = appendAttr([]byte{' '}, set, value)
+	}
+	if len(add) == 0 {
+		return append(out, b[last:t.end]...)
+	}
+	if last < t.attrEnd {
+		out = append(out, b[last:t.attrEnd]...)
+	}
+	out = append(out, add...)
+	if t.selfClosing {
+		out = append(out, '/')
+	}
+	return append(out, '>')
+}
+
+// appendAttr appends name="value" to out. value must already be escaped.
+func appendAttr(out []byte, name string, value []byte) []byte {
+	out = append(out, name...)
+	out = append(out, '=', '"')
+	out = append(out, value...)
+	return append(out, '"')
+}
@@ -0,0 +1,213 @@
+package fillinform
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	b := []byte(`<INPUT Type=text name='title' value="a > b" data-x checked/>`)
+	tag, state := parseTag(b, 0, true)
+	if state != tagOK {
+		t.Fatalf("parseTag state error: %v", state)
+	}
+	if !tag.is(_Input) || tag.end != len(b) || !tag.selfClosing {
+		t.Errorf("parseTag tag error: %+v", tag)
+	}
+	if v, _ := tag.get(_Type); string(v) != "text" {
+		t.Errorf("parseTag type error: %s", v)
+	}
+	if v, _ := tag.get(_Value); string(v) != "a > b" {
+		t.Errorf("parseTag value error: %s", v)
+	}
+	if _, ok := tag.get(_Checked); !ok {
+		t.Errorf("parseTag boolean attribute error")
+	}
+	if _, ok := tag.get("x"); ok {
+		t.Errorf("parseTag unknown attribute error")
+	}
+
+	partial := map[string]int{
+		`<`:                  tagPartial,
+		`<inp`:               tagPartial,
+		`<input name="ti`:    tagPartial,
+		`<input name=title/`: tagPartial,
+		`< input>`:           tagNone,
+		`<!-- x -->`:         tagNone,
+		`<input name="a"/x>`: tagNone,
+		`</form >`:           tagOK,
+	}
+	for src, want := range partial {
+		if _, state := parseTag([]byte(src), 0, false); state != want {
+			t.Errorf("parseTag %q state: got %v want %v", src, state, want)
+		}
+	}
+}
+
+func TestParseTagAttributes(t *testing.T) {
+	b := []byte(`<input data-name="x" typename=y name = 'title' value="a" VALUE="b" data-value='"q"' v-bind:value=v @click.prevent="go()" disabled type="text"class="c">`)
+	tag, state := parseTag(b, 0, true)
+	if state != tagOK {
+		t.Fatalf("parseTag state error: %v", state)
+	}
+	for name, want := range map[string]string{
+		"name":           "title",
+		"value":          "a",
+		"data-name":      "x",
+		"typename":       "y",
+		"data-value":     `"q"`,
+		"v-bind:value":   "v",
+		"@click.prevent": "go()",
+		"disabled":       "",
+		"type":           "text",
+		"class":          "c",
+	} {
+		if v, ok := tag.get(name); !ok || string(v) != want {
+			t.Errorf("parseTag attribute %s error: %q %v", name, v, ok)
+		}
+	}
+	if len(tag.attrs) != 11 {
+		t.Errorf("parseTag attributes error: %d", len(tag.attrs))
+	}
+
+	out := tag.rewrite(b, "", _Value, []byte("new"), nil)
+	if string(out) != `<input data-name="x" typename=y name = 'title' value="new" VALUE="b" data-value='"q"' v-bind:value=v @click.prevent="go()" disabled type="text"class="c">` {
+		t.Errorf("rewrite error: %s", out)
+	}
+}
+
+func TestFillAttributes(t *testing.T) {
+	formData := map[string][]string{"title": []string{"hoge"}, "x": []string{"fuga"}}
+	htmlstr, _ := Fill([]byte(`<form><input data-name="x" name="title" data-value="y"><input typename="x" name ="x" value = "old"></form>`), formData, nil)
+	if string(htmlstr) != `<form><input data-name="x" name="title" data-value="y" value="hoge"><input typename="x" name ="x" value="fuga"></form>` {
+		t.Errorf("fill attributes error: %s", htmlstr)
+	}
+}
+
+func TestFindForm(t *testing.T) {
+	b := []byte(`<p>x</p><FORM id="a"><input name="t"></Form>tail`)
+	start, end, complete := findForm(b, 0)
+	if start != 8 || string(b[end:]) != "tail" || !complete {
+		t.Errorf("findForm error: %v %v %v", start, end, complete)
+	}
+
+	for src, want := range map[string]int{
+		`<p>x</p><fo`:                3 + 5,
+		`<p>x</p><form id="a"><inp`:  3 + 5,
+		`<p>x</p><formula id="a">`:   -1,
+		`<p>x</p><div class="a`:      3 + 5,
+		`<p>x</p><select><option>`:   3 + 5,
+		`<p>x</p><select></select>`:  -1,
+		`<p>x</p><form id="a"></for`: 3 + 5,
+	} {
+		if start, _, complete := findForm([]byte(src), 0); start != want || complete {
+			t.Errorf("findForm %q: got %v %v", src, start, complete)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	b := []byte(`<input value=x checked=checked type="radio" />`)
+	tag, _ := parseTag(b, 0, true)
+	if out := tag.rewrite(b, _Checked, "", nil, checkedBytes); string(out) != `<input value=x type="radio" checked="checked"/>` {
+		t.Errorf("rewrite add error: %s", out)
+	}
+	if out := tag.rewrite(b, "", _Value, []byte(`y`), nil); string(out) != `<input value="y" checked=checked type="radio" />` {
+		t.Errorf("rewrite set error: %s", out)
+	}
+	if out := tag.rewrite(b, _Value, "", nil, nil); string(out) != `<input checked=checked type="radio" />` {
+		t.Errorf("rewrite drop error: %s", out)
+	}
+}
+
+func BenchmarkParseTag(b *testing.B) {
+	bstr := []byte(`<input autocapitalize="off" type="password" name="user_pass" size="25" maxlength="16" istyle="4">`)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parseTag(bstr, 0, true)
+	}
+}
+
+func TestFindFormSkips(t *testing.T) {
+	for src, want := range map[string]int{
+		`<!-- <form></form> --><form></form>`:                   22,
+		`<script>s = "<form></form>"</script><form></form>`:     36,
+		`<STYLE>form</STYLE><textarea><form></form></textarea>`: -1,
+		`<!DOCTYPE html><?xml x?><title><form></title>`:         -1,
+		`<template><form></form></template>`:                    0,
+	} {
+		if start, _, _ := findForm([]byte(src), 0); start != want {
+			t.Errorf("findForm %q: got %v want %v", src, start, want)
+		}
+	}
+
+	// regions that run to the end are held back
+	for src, want := range map[string]int{
+		`<p></p><!-- <form>`:      7,
+		`<p></p><!-`:              7,
+		`<p></p><script>x`:        7,
+		`<p></p><scr`:             7,
+		`<p></p><templ`:           7,
+		`<p></p><template><form>`: 7,
+	} {
+		if start, _, complete := findForm([]byte(src), 0); start != want || complete {
+			t.Errorf("findForm %q: got %v %v", src, start, complete)
+		}
+	}
+
+	b := []byte(`<form><script>"</form>"</script><!-- </form> --><textarea></form></textarea></form>tail`)
+	if _, end, complete := findForm(b, 0); string(b[end:]) != "tail" || !complete {
+		t.Errorf("findForm end error: %v %v", end, complete)
+	}
+	b = []byte(`<template><template></template><form></form></template>tail`)
+	if _, end, complete := findForm(b, 0); string(b[end:]) != "tail" || !complete {
+		t.Errorf("findForm template end error: %v %v", end, complete)
+	}
+}
+
+var HTMLRegions = `<script>document.write('<form><input name="title"></form>')</script>
+<!-- <form><input name="title"></form> -->
+<textarea><form><input name="title"></form></textarea>
+<form>
+<script>var s = '<input name="title">';</script>
+<!-- <input name="title"> -->
+<input name="title">
+<template><input name="title"></template>
+</form>
+<template><form><input name="title"></form></template>`
+
+func TestFillSkipsRegions(t *testing.T) {
+	formData := map[string][]string{"title": []string{"hoge"}}
+	htmlstr, err := Fill([]byte(HTMLRegions), formData, nil)
+	if err != nil {
+		t.Fatalf("fill error: %v", err)
+	}
+	if string(htmlstr) != strings.Replace(HTMLRegions, "\n<input name=\"title\">", "\n<input name=\"title\" value=\"hoge\">", 1) {
+		t.Errorf("fill regions error: %s", htmlstr)
+	}
+
+	htmlstr, _ = Fill([]byte(HTMLRegions), formData, map[string]interface{}{"FillTemplates": true})
+	want := strings.Replace(HTMLRegions, "\n<input name=\"title\">", "\n<input name=\"title\" value=\"hoge\">", 1)
+	want = strings.Replace(want, "<template><input name=\"title\">", "<template><input name=\"title\" value=\"\">", 1)
+	want = strings.Replace(want, "<template><form><input name=\"title\">", "<template><form><input name=\"title\" value=\"hoge\">", 1)
+	if string(htmlstr) != want {
+		t.Errorf("fill templates error: %s", htmlstr)
+	}
+
+	var buf bytes.Buffer
+	w := FillWriter(&buf, formData, nil)
+	for i := 0; i < len(HTMLRegions); i += 3 {
+		end := i + 3
+		if end > len(HTMLRegions) {
+			end = len(HTMLRegions)
+		}
+		w.Write([]byte(HTMLRegions[i:end]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("writer error: %v", err)
+	}
+	if buf.String() != strings.Replace(HTMLRegions, "\n<input name=\"title\">", "\n<input name=\"title\" value=\"hoge\">", 1) {
+		t.Errorf("writer regions error: %s", buf.String())
+	}
+}
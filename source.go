@@ -0,0 +1,117 @@
+package fillinform
+
+import (
+	"net/url"
+	"reflect"
+)
+
+// DataSource supplies the values filled into the controls named name.
+// ok is false when the source has no values for name.
+type DataSource interface {
+	Values(name string) (values []string, ok bool)
+}
+
+// Map is a DataSource backed by a map, the data taken by Fill.
+type Map map[string][]string
+
+func (m Map) Values(name string) ([]string, bool) {
+	vals, ok := m[name]
+	return vals, ok
+}
+
+// URLValues is a DataSource backed by url.Values, such as http.Request.Form.
+type URLValues url.Values
+
+func (v URLValues) Values(name string) ([]string, bool) {
+	vals, ok := v[name]
+	return vals, ok
+}
+
+// AnyMap is a DataSource backed by a map of arbitrary values, such as decoded
+// JSON or session data. Values are converted as the fields of FillStruct are,
+// a nil value or one that cannot be converted counts as missing.
+type AnyMap map[string]interface{}
+
+func (m AnyMap) Values(name string) ([]string, bool) {
+	v, ok := m[name]
+	if !ok {
+		return nil, false
+	}
+	vals, ok, err := formatValue(reflect.ValueOf(&v).Elem(), "")
+	if err != nil {
+		return nil, false
+	}
+	return vals, ok
+}
+
+// DataSourceFunc is a DataSource that calls the function itself, e.g. for
+// values looked up lazily.
+type DataSourceFunc func(name string) ([]string, bool)
+
+func (fn DataSourceFunc) Values(name string) ([]string, bool) {
+	return fn(name)
+}
+
+// Layers is a DataSource that takes the values of a name from the first of
+// its sources that has them, e.g. submitted values before saved ones before
+// defaults. A Filler with the FallThroughEmpty option skips sources whose
+// values are all empty.
+type Layers []DataSource
+
+func (l Layers) Values(name string) ([]string, bool) {
+	for _, src := range l {
+		if vals, ok := src.Values(name); ok {
+			return vals, true
+		}
+	}
+	return nil, false
+}
+
+// FillSource returns body with its forms filled with the values of src.
+// A nil src has no values.
+func FillSource(body []byte, src DataSource, options map[string]interface{}) ([]byte, error) {
+	filler, err := NewFiller(WithOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	return filler.FillSource(body, src)
+}
+
+// FillSource returns body with its forms filled with the values of srcs.
+// Each name is looked up in srcs in order, as by Layers.
+func (f *Filler) FillSource(body []byte, srcs ...DataSource) ([]byte, error) {
+	return f.newSourceState(srcs...).fill(body)
+}
+
+// FillForms returns body with each form filled with its own data. forms is
+// keyed by form id or, for forms without a matching id, by form name. Other
+// forms are filled from fallback, or left untouched when fallback is nil.
+// Controls outside of forms are filled from fallback only with the
+// FillOutside option.
+func FillForms(body []byte, forms map[string]DataSource, fallback DataSource, options map[string]interface{}) ([]byte, error) {
+	filler, err := NewFiller(WithOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	return filler.FillForms(body, forms, fallback)
+}
+
+// FillForms returns body with each form filled with its own data, as the
+// package level FillForms does.
+func (f *Filler) FillForms(body []byte, forms map[string]DataSource, fallback DataSource) ([]byte, error) {
+	s := f.newSourceState(fallback)
+	s.dataFor = func(formTag *tag) DataSource {
+		if formTag == nil {
+			return fallback
+		}
+		for _, attr := range []string{_Id, _Name} {
+			if key, ok := formTag.get(attr); ok {
+				if src, ok := forms[string(decodeEntity(key))]; ok {
+					return src
+				}
+			}
+		}
+		return fallback
+	}
+	return s.fill(body)
+}
@@ -0,0 +1,131 @@
+package fillinform
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestDataSources(t *testing.T) {
+	tests := []struct {
+		src  DataSource
+		vals []string
+		ok   bool
+	}{
+		{Map{"title": []string{"hoge"}}, []string{"hoge"}, true},
+		{Map{}, nil, false},
+		{URLValues(url.Values{"title": []string{"hoge", "fuga"}}), []string{"hoge", "fuga"}, true},
+		{AnyMap{"title": "hoge"}, []string{"hoge"}, true},
+		{AnyMap{"title": 1.5}, []string{"1.5"}, true},
+		{AnyMap{"title": []interface{}{"hoge", 2}}, []string{"hoge", "2"}, true},
+		{AnyMap{"title": nil}, nil, false},
+		{AnyMap{"title": map[string]string{}}, nil, false},
+		{DataSourceFunc(func(name string) ([]string, bool) {
+			return []string{name}, true
+		}), []string{"title"}, true},
+	}
+	for _, test := range tests {
+		vals, ok := test.src.Values("title")
+		if ok != test.ok || !reflect.DeepEqual(vals, test.vals) {
+			t.Errorf("data source error: %#v: %v, %v", test.src, vals, ok)
+		}
+	}
+}
+
+func TestFillSource(t *testing.T) {
+	src := AnyMap{
+		"title":  "hogeTitle",
+		"chk":    1,
+		"rdo":    "rdoval2",
+		"select": []int{1},
+		"body":   "hogehoge",
+	}
+	htmlstr, err := FillSource([]byte(HTMLMulti), src, map[string]interface{}{"Target": "myform2"})
+	if err != nil {
+		t.Fatalf("fill source error: %v", err)
+	}
+	if string(htmlstr) != HTMLMultiSuccess {
+		t.Errorf("fillinform error: %v", string(htmlstr))
+	}
+
+	calls := 0
+	lazy := DataSourceFunc(func(name string) ([]string, bool) {
+		calls++
+		return []string{"lazy1", "lazy2"}, name == "title"
+	})
+	filler, _ := NewFiller()
+	htmlstr, _ = filler.FillSource([]byte(`<form><input name="title"><input name="title"></form>`), lazy)
+	if string(htmlstr) != `<form><input name="title" value="lazy1"><input name="title" value="lazy2"></form>` || calls != 1 {
+		t.Errorf("fill source error: %v, %d calls", string(htmlstr), calls)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	submitted := Map{"title": []string{""}, "body": []string{"submitted"}}
+	profile := Map{"title": []string{"profile"}, "chk": []string{"1"}}
+	defaults := AnyMap{"title": "default", "chk": 0, "rdo": "rdoval2"}
+	html := []byte(`<form><input name="title"><input name="body"><input type="checkbox" name="chk" value="1"><input type="radio" name="rdo" value="rdoval2"></form>`)
+
+	filler, _ := NewFiller()
+	htmlstr, _ := filler.FillSource(html, submitted, profile, defaults)
+	if string(htmlstr) != `<form><input name="title" value=""><input name="body" value="submitted"><input type="checkbox" name="chk" value="1" checked="checked"><input type="radio" name="rdo" value="rdoval2" checked="checked"></form>` {
+		t.Errorf("layers error: %v", string(htmlstr))
+	}
+	htmlstr, _ = FillSource(html, Layers{submitted, profile, defaults}, nil)
+	if string(htmlstr) != `<form><input name="title" value=""><input name="body" value="submitted"><input type="checkbox" name="chk" value="1" checked="checked"><input type="radio" name="rdo" value="rdoval2" checked="checked"></form>` {
+		t.Errorf("layers error: %v", string(htmlstr))
+	}
+
+	filler, _ = NewFiller(WithFallThroughEmpty(true))
+	htmlstr, _ = filler.FillSource(html, submitted, profile, defaults)
+	if string(htmlstr) != `<form><input name="title" value="profile"><input name="body" value="submitted"><input type="checkbox" name="chk" value="1" checked="checked"><input type="radio" name="rdo" value="rdoval2" checked="checked"></form>` {
+		t.Errorf("layers fall through error: %v", string(htmlstr))
+	}
+	htmlstr, _ = FillSource(html, Layers{submitted, Layers{profile}, defaults}, map[string]interface{}{"FallThroughEmpty": true})
+	if string(htmlstr) != `<form><input name="title" value="profile"><input name="body" value="submitted"><input type="checkbox" name="chk" value="1" checked="checked"><input type="radio" name="rdo" value="rdoval2" checked="checked"></form>` {
+		t.Errorf("layers fall through error: %v", string(htmlstr))
+	}
+	htmlstr, _ = filler.FillSource([]byte(`<form><input name="title"></form>`), submitted, Map{"title": nil})
+	if string(htmlstr) != `<form><input name="title" value=""></form>` {
+		t.Errorf("layers all empty error: %v", string(htmlstr))
+	}
+}
+
+func TestNilSource(t *testing.T) {
+	src := `<form><input name="title" value="old"></form>`
+	htmlstr, err := FillSource([]byte(src), nil, nil)
+	if err != nil || string(htmlstr) != `<form><input name="title" value=""></form>` {
+		t.Errorf("nil source error: %v %v", string(htmlstr), err)
+	}
+	filler, _ := NewFiller()
+	htmlstr, err = filler.FillSource([]byte(src), nil, Map{"title": []string{"hoge"}})
+	if err != nil || string(htmlstr) != `<form><input name="title" value="hoge"></form>` {
+		t.Errorf("nil layer error: %v %v", string(htmlstr), err)
+	}
+	htmlstr, _ = filler.FillSource([]byte(src), nil)
+	if string(htmlstr) != `<form><input name="title" value=""></form>` {
+		t.Errorf("nil source error: %v", string(htmlstr))
+	}
+}
+
+func TestFillForms(t *testing.T) {
+	src := `<form id="profile"><input name="email"></form><form id="password"><input name="email"><input type="password" name="pass"></form><form name="newsletter"><input name="email"></form><form><input name="email"></form><input name="email" form="profile">`
+	forms := map[string]DataSource{
+		"profile":    Map{"email": []string{"me@example.com", "me2@example.com"}},
+		"newsletter": AnyMap{"email": "news@example.com"},
+	}
+
+	htmlstr, err := FillForms([]byte(src), forms, nil, nil)
+	if err != nil {
+		t.Fatalf("fill forms error: %v", err)
+	}
+	if string(htmlstr) != `<form id="profile"><input name="email" value="me@example.com"></form><form id="password"><input name="email"><input type="password" name="pass"></form><form name="newsletter"><input name="email" value="news@example.com"></form><form><input name="email"></form><input name="email" form="profile" value="me2@example.com">` {
+		t.Errorf("fill forms error: %v", string(htmlstr))
+	}
+
+	filler, _ := NewFiller(WithFillOutside(true))
+	htmlstr, _ = filler.FillForms([]byte(src+`<input name="email">`), forms, Map{"email": []string{"other@example.com"}})
+	if string(htmlstr) != `<form id="profile"><input name="email" value="me@example.com"></form><form id="password"><input name="email" value="other@example.com"><input type="password" name="pass"></form><form name="newsletter"><input name="email" value="news@example.com"></form><form><input name="email" value="other@example.com"></form><input name="email" form="profile" value="me2@example.com"><input name="email" value="other@example.com">` {
+		t.Errorf("fill forms fallback error: %v", string(htmlstr))
+	}
+}
@@ -0,0 +1,252 @@
+package fillinform
+
+import (
+	"encoding"
+	"fmt"
+	"image/color"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FillStruct fills body with the fields of the struct v.
+// A field is filled into the control named by its `form:"name"` tag, or by
+// the field name when there is no tag. `form:"-"` skips the field and
+// `form:"name,omitempty"` skips it when it holds the zero value.
+//
+// Strings, bools, ints, floats, fmt.Stringer, encoding.TextMarshaler and
+// color.Color (as #rrggbb) are converted to a single value, slices and
+// arrays to one value per element (for multiple selects and checkboxes).
+// Pointers are followed, a nil pointer leaves the field out. time.Time is
+// formatted as RFC 3339 unless the field has a `layout:"2006-01-02"` tag;
+// date and time inputs get the format their type requires either way.
+// Embedded structs are flattened. Other fields that are not converted to
+// values, such as struct fields, maps and slices of structs, are left out;
+// with the NestedNames option they are reached by names like addr[city].
+func FillStruct(body []byte, v interface{}, options map[string]interface{}) ([]byte, error) {
+	filler, err := NewFiller(WithOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	return filler.FillStruct(body, v)
+}
+
+// FillStruct fills body with the fields of the struct v, as the package
+// level FillStruct does.
+func (f *Filler) FillStruct(body []byte, v interface{}) ([]byte, error) {
+	data, err := structValues(v)
+	if err != nil {
+		return nil, err
+	}
+	return f.FillSource(body, structSource{Map(data), nested{reflect.ValueOf(v)}})
+}
+
+// structValues flattens the struct v into form values.
+func structValues(v interface{}) (map[string][]string, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("fillinform: FillStruct of non-struct type %T", v)
+	}
+	if !rv.CanAddr() {
+		// make methods with pointer receivers reachable
+		cp := reflect.New(rv.Type()).Elem()
+		cp.Set(rv)
+		rv = cp
+	}
+	data := make(map[string][]string)
+	if err := addStruct(data, rv); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func addStruct(data map[string][]string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		name, omitempty := fieldTag(sf)
+		if name == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+
+		if sf.Anonymous && name == "" && isPlainStruct(fv) {
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if err := addStruct(data, fv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if omitempty && fv.IsZero() {
+			continue
+		}
+		vals, ok, err := formatValue(fv, sf.Tag.Get("layout"))
+		if err != nil {
+			return fmt.Errorf("fillinform: field %s: %v", sf.Name, err)
+		}
+		if ok {
+			data[name] = vals
+		}
+	}
+	return nil
+}
+
+// fieldTag returns the name in the form tag of sf, "-" for a skipped field,
+// and whether the tag has the omitempty option.
+func fieldTag(sf reflect.StructField) (name string, omitempty bool) {
+	tag := sf.Tag.Get("form")
+	if tag == "-" {
+		return tag, false
+	}
+	name, opt := tag, ""
+	if n := strings.IndexByte(tag, ','); n >= 0 {
+		name, opt = tag[:n], tag[n+1:]
+	}
+	return name, opt == "omitempty"
+}
+
+// isPlainStruct reports whether fv is a struct, or a pointer to one, that
+// is not converted to a value by itself.
+func isPlainStruct(fv reflect.Value) bool {
+	t := fv.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	for _, it := range []reflect.Type{textMarshalerType, stringerType, colorType} {
+		if t.Implements(it) || reflect.PtrTo(t).Implements(it) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	colorType         = reflect.TypeOf((*color.Color)(nil)).Elem()
+)
+
+// formatValue returns the form values of fv. ok is false for a nil pointer
+// and for types that are not converted to values.
+func formatValue(fv reflect.Value, layout string) (vals []string, ok bool, err error) {
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil, false, nil
+		}
+		fv = fv.Elem()
+	}
+	if s, ok, err := formatScalar(fv, layout); ok || err != nil {
+		return []string{s}, ok, err
+	}
+	if fv.Kind() != reflect.Slice && fv.Kind() != reflect.Array {
+		return nil, false, nil
+	}
+	et := fv.Type().Elem()
+	for et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Interface {
+		// a slice of structs or maps, even an empty one
+		if _, ok, err := formatScalar(reflect.New(et).Elem(), layout); !ok && err == nil {
+			return nil, false, nil
+		}
+	}
+	vals = make([]string, 0, fv.Len())
+	for i := 0; i < fv.Len(); i++ {
+		e := fv.Index(i)
+		for e.Kind() == reflect.Ptr || e.Kind() == reflect.Interface {
+			if e.IsNil() {
+				break
+			}
+			e = e.Elem()
+		}
+		if e.Kind() == reflect.Ptr || e.Kind() == reflect.Interface {
+			continue
+		}
+		s, ok, err := formatScalar(e, layout)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			return nil, false, nil
+		}
+		vals = append(vals, s)
+	}
+	return vals, true, nil
+}
+
+// formatScalar returns fv as a single value. ok is false when fv is not
+// converted to a single value.
+func formatScalar(fv reflect.Value, layout string) (s string, ok bool, err error) {
+	if fv.CanInterface() {
+		if s, ok, err := formatInterface(fv.Interface(), layout); ok || err != nil {
+			return s, ok, err
+		}
+		if fv.CanAddr() {
+			if s, ok, err := formatInterface(fv.Addr().Interface(), layout); ok || err != nil {
+				return s, ok, err
+			}
+		}
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(fv.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, fv.Type().Bits()), true, nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(fv.Bytes()), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func formatInterface(v interface{}, layout string) (string, bool, error) {
+	switch x := v.(type) {
+	case time.Time:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return x.Format(layout), true, nil
+	case *time.Time:
+		return formatInterface(*x, layout)
+	case encoding.TextMarshaler:
+		b, err := x.MarshalText()
+		if err != nil {
+			return "", false, err
+		}
+		return string(b), true, nil
+	case fmt.Stringer:
+		return x.String(), true, nil
+	case color.Color:
+		return formatColor(x), true, nil
+	}
+	return "", false, nil
+}
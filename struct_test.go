@@ -0,0 +1,132 @@
+package fillinform
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testColor int
+
+func (c testColor) String() string {
+	return [...]string{"red", "green", "blue"}[c]
+}
+
+type testBase struct {
+	ID int `form:"id"`
+}
+
+type testProfile struct {
+	testBase
+	Name     string    `form:"user_name"`
+	Age      int       `form:"age"`
+	Height   float64   `form:"height"`
+	Admin    bool      `form:"admin"`
+	Birth    time.Time `form:"birth" layout:"2006-01-02"`
+	Updated  time.Time `form:"updated"`
+	Color    testColor `form:"color"`
+	IP       net.IP    `form:"ip"`
+	Hobbies  []string  `form:"hobby"`
+	Scores   [2]uint8  `form:"score"`
+	Nick     *string   `form:"nick"`
+	Zip      *int      `form:"zip"`
+	Note     string    `form:"note,omitempty"`
+	Secret   string    `form:"-"`
+	Raw      []byte
+	internal string
+}
+
+func TestStructValues(t *testing.T) {
+	nick := "hoge"
+	p := testProfile{
+		testBase: testBase{ID: 7},
+		Name:     "sheer<cat>",
+		Age:      20,
+		Height:   170.5,
+		Admin:    true,
+		Birth:    time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+		Updated:  time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC),
+		Color:    2,
+		IP:       net.IPv4(127, 0, 0, 1),
+		Hobbies:  []string{"go", "perl"},
+		Scores:   [2]uint8{1, 2},
+		Nick:     &nick,
+		Secret:   "secret",
+		Raw:      []byte("raw"),
+		internal: "internal",
+	}
+	want := map[string][]string{
+		"id":        []string{"7"},
+		"user_name": []string{"sheer<cat>"},
+		"age":       []string{"20"},
+		"height":    []string{"170.5"},
+		"admin":     []string{"true"},
+		"birth":     []string{"2000-01-02"},
+		"updated":   []string{"2020-03-04T05:06:07Z"},
+		"color":     []string{"blue"},
+		"ip":        []string{"127.0.0.1"},
+		"hobby":     []string{"go", "perl"},
+		"score":     []string{"1", "2"},
+		"nick":      []string{"hoge"},
+		"Raw":       []string{"raw"},
+	}
+	for _, v := range []interface{}{p, &p} {
+		data, err := structValues(v)
+		if err != nil {
+			t.Fatalf("struct values error: %v", err)
+		}
+		if !reflect.DeepEqual(data, want) {
+			t.Errorf("struct values error: %v", data)
+		}
+	}
+
+	if _, err := structValues(map[string]string{}); err == nil {
+		t.Errorf("non-struct should fail")
+	}
+	data, err := structValues(struct {
+		Name  string
+		Addr  struct{ City string }
+		M     map[string]string
+		Items []struct{ Qty int }
+	}{Name: "hoge", M: map[string]string{"a": "b"}})
+	if err != nil || !reflect.DeepEqual(data, map[string][]string{"Name": []string{"hoge"}}) {
+		t.Errorf("unflattened fields should be left out: %v %v", data, err)
+	}
+}
+
+func TestFillStruct(t *testing.T) {
+	p := struct {
+		Title  string   `form:"title"`
+		Chk    int      `form:"chk"`
+		Rdo    string   `form:"rdo"`
+		Select []string `form:"select"`
+		Body   string   `form:"body"`
+	}{"hogeTitle", 1, "rdoval2", []string{"1"}, "hogehoge"}
+
+	htmlstr, err := FillStruct([]byte(HTMLMulti), &p, map[string]interface{}{"Target": "myform2"})
+	if err != nil {
+		t.Fatalf("fill struct error: %v", err)
+	}
+	if string(htmlstr) != HTMLMultiSuccess {
+		t.Errorf("fillinform error: %v", string(htmlstr))
+	}
+
+	type address struct {
+		City string
+	}
+	q := struct {
+		Name string  `form:"name"`
+		Addr address `form:"addr"`
+		Tags map[string]string
+	}{"hoge", address{"Tokyo"}, map[string]string{"a": "b"}}
+	htmlstr, err = FillStruct([]byte(`<form><input name="name"><input name="addr"></form>`), q, nil)
+	if err != nil || string(htmlstr) != `<form><input name="name" value="hoge"><input name="addr" value=""></form>` {
+		t.Errorf("fill struct with nested fields error: %v %v", string(htmlstr), err)
+	}
+
+	htmlstr, err = FillStruct([]byte(`<form><input name="name"><input name="addr[City]"><input name="addr.City"><input name="Tags[a]"></form>`), q, map[string]interface{}{"NestedNames": true})
+	if err != nil || string(htmlstr) != `<form><input name="name" value="hoge"><input name="addr[City]" value="Tokyo"><input name="addr.City" value="Tokyo"><input name="Tags[a]" value="b"></form>` {
+		t.Errorf("fill struct nested names error: %v %v", string(htmlstr), err)
+	}
+}
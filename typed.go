@@ -0,0 +1,231 @@
+package fillinform
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// TypedSource is a DataSource that also returns values as they are, before
+// they are converted to strings. Inputs of type date, month, week, time,
+// datetime-local, number, range and color are filled with typed values
+// formatted the way the type requires: time.Time for the date and time
+// types, integers and floats for number and range, color.Color for color.
+// The path is the name split by its keys, as for NestedSource.
+type TypedSource interface {
+	TypedLookup(path []string) (values []interface{}, ok bool)
+}
+
+// InvalidPolicy decides what happens to a value that is not valid for the
+// type of its input, such as "tomorrow" for type="date".
+type InvalidPolicy int
+
+const (
+	// InvalidAsIs writes the value as it is. This is the default.
+	InvalidAsIs InvalidPolicy = iota
+	// InvalidClear fills the input with an empty value.
+	InvalidClear
+	// InvalidReport fills the input with an empty value and makes the fill
+	// return a *ValueError.
+	InvalidReport
+)
+
+// TypedLookup returns the values in m found by path as they are.
+func (m AnyMap) TypedLookup(path []string) ([]interface{}, bool) {
+	return typedLookup(reflect.ValueOf(map[string]interface{}(m)), path)
+}
+
+func (n nested) TypedLookup(path []string) ([]interface{}, bool) {
+	return typedLookup(n.v, path)
+}
+
+// structSource has the flattened fields of a struct, and the fields as they
+// are for typed inputs.
+type structSource struct {
+	Map
+	typed nested
+}
+
+func (s structSource) TypedLookup(path []string) ([]interface{}, bool) {
+	return s.typed.TypedLookup(path)
+}
+
+// Lookup resolves nested names against the struct, so FillStruct fills
+// addr[city] from the City field of Addr with the NestedNames option.
+func (s structSource) Lookup(path []string) ([]string, bool) {
+	return s.typed.Lookup(path)
+}
+
+func typedLookup(v reflect.Value, path []string) ([]interface{}, bool) {
+	leaf, _, ok := lookupLeaf(v, path)
+	if !ok {
+		return nil, false
+	}
+	for leaf.Kind() == reflect.Ptr || leaf.Kind() == reflect.Interface {
+		if leaf.IsNil() {
+			return nil, false
+		}
+		leaf = leaf.Elem()
+	}
+	if !leaf.CanInterface() {
+		return nil, false
+	}
+	if (leaf.Kind() == reflect.Slice || leaf.Kind() == reflect.Array) && leaf.Type().Elem().Kind() != reflect.Uint8 {
+		vals := make([]interface{}, 0, leaf.Len())
+		for i := 0; i < leaf.Len(); i++ {
+			vals = append(vals, leaf.Index(i).Interface())
+		}
+		return vals, true
+	}
+	return []interface{}{leaf.Interface()}, true
+}
+
+// typedInputs are the input types whose values have a required syntax.
+var typedInputs = map[string]*regexp.Regexp{
+	"date":           regexp.MustCompile(`^\d{4,}-\d{2}-\d{2}$`),
+	"month":          regexp.MustCompile(`^\d{4,}-\d{2}$`),
+	"week":           regexp.MustCompile(`^\d{4,}-W\d{2}$`),
+	"time":           regexp.MustCompile(`^` + clockRxp + `$`),
+	"datetime-local": regexp.MustCompile(`^\d{4,}-\d{2}-\d{2}[T ]` + clockRxp + `$`),
+	"number":         regexp.MustCompile(`^-?(\d+(\.\d+)?|\.\d+)([eE][-+]?\d+)?$`),
+	"range":          regexp.MustCompile(`^-?(\d+(\.\d+)?|\.\d+)([eE][-+]?\d+)?$`),
+	"color":          regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`),
+}
+
+const clockRxp = `([01]\d|2[0-3]):[0-5]\d(:[0-5]\d(\.\d{1,3})?)?`
+
+// formatInput returns the value for the input of type typ that takes the
+// i-th value of p, formatted or checked for the type.
+func (f *fillState) formatInput(typ, name string, p *param, i int, value []byte) []byte {
+	if !p.typedDone {
+		p.typedDone = true
+		if ts, ok := p.src.(TypedSource); ok {
+			p.typed, _ = ts.TypedLookup(p.path)
+		}
+	}
+	if i < len(p.typed) {
+		if v, ok := formatTyped(typ, p.typed[i]); ok {
+			return v
+		}
+	}
+	if len(value) == 0 || validInput(typ, value) {
+		return value
+	}
+	if isDateInput(typ) {
+		// RFC 3339, as FillStruct and JSON encoders write times
+		if t, err := time.Parse(time.RFC3339Nano, string(value)); err == nil {
+			v, _ := formatTyped(typ, t)
+			return v
+		}
+	}
+	switch f.opts.Invalid {
+	case InvalidClear:
+		return nil
+	case InvalidReport:
+		if f.err == nil {
+			f.err = &ValueError{Name: name, Type: typ, Value: string(value)}
+		}
+		return nil
+	}
+	return value
+}
+
+func isDateInput(typ string) bool {
+	switch typ {
+	case "date", "month", "week", "time", "datetime-local":
+		return true
+	}
+	return false
+}
+
+// validInput reports whether value is valid for an input of type typ.
+func validInput(typ string, value []byte) bool {
+	if !typedInputs[typ].Match(value) {
+		return false
+	}
+	s := string(value)
+	switch typ {
+	case "date":
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	case "month":
+		_, err := time.Parse("2006-01", s)
+		return err == nil
+	case "week":
+		year, _ := strconv.Atoi(s[:len(s)-4])
+		week, _ := strconv.Atoi(s[len(s)-2:])
+		_, last := time.Date(year, 12, 28, 0, 0, 0, 0, time.UTC).ISOWeek()
+		return week >= 1 && week <= last
+	case "datetime-local":
+		_, err := time.Parse("2006-01-02", s[:bytes.IndexAny(value, "T ")])
+		return err == nil
+	}
+	return true
+}
+
+// formatTyped formats v for an input of type typ. ok is false when v is not
+// of a type typ takes.
+func formatTyped(typ string, v interface{}) ([]byte, bool) {
+	if tp, ok := v.(*time.Time); ok && tp != nil {
+		v = *tp
+	}
+	switch typ {
+	case "date", "month", "week", "time", "datetime-local":
+		t, ok := v.(time.Time)
+		if !ok {
+			return nil, false
+		}
+		switch typ {
+		case "date":
+			return []byte(t.Format("2006-01-02")), true
+		case "month":
+			return []byte(t.Format("2006-01")), true
+		case "week":
+			year, week := t.ISOWeek()
+			return []byte(fmt.Sprintf("%04d-W%02d", year, week)), true
+		case "time":
+			return []byte(formatClock(t)), true
+		}
+		return []byte(t.Format("2006-01-02T") + formatClock(t)), true
+	case "number", "range":
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return []byte(strconv.FormatInt(rv.Int(), 10)), true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return []byte(strconv.FormatUint(rv.Uint(), 10)), true
+		case reflect.Float32, reflect.Float64:
+			if fv := rv.Float(); !math.IsNaN(fv) && !math.IsInf(fv, 0) {
+				return []byte(strconv.FormatFloat(fv, 'f', -1, rv.Type().Bits())), true
+			}
+		}
+	case "color":
+		if c, ok := v.(color.Color); ok {
+			return []byte(formatColor(c)), true
+		}
+	}
+	return nil, false
+}
+
+// formatColor formats c as #rrggbb, without alpha.
+func formatColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+}
+
+// formatClock formats the time of day of t, with seconds and milliseconds
+// only when they are set.
+func formatClock(t time.Time) string {
+	switch {
+	case t.Nanosecond() >= int(time.Millisecond):
+		return t.Format("15:04:05.000")
+	case t.Second() != 0:
+		return t.Format("15:04:05")
+	}
+	return t.Format("15:04")
+}
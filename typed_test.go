@@ -0,0 +1,111 @@
+package fillinform
+
+import (
+	"image/color"
+	"testing"
+	"time"
+)
+
+var HTMLTyped = `<form><input type="date" name="date"><input type="month" name="month"><input type="week" name="week"><input type="time" name="time"><input type="datetime-local" name="dt"><input type="number" name="num"><input type="range" name="rng"><input type="color" name="color"><input name="text"></form>`
+
+func TestFillTyped(t *testing.T) {
+	at := time.Date(2021, 1, 3, 9, 5, 0, 0, time.UTC)
+	src := AnyMap{
+		"date":  at,
+		"month": &at,
+		"week":  at,
+		"time":  at.Add(7 * time.Second),
+		"dt":    at.Add(1500 * time.Millisecond),
+		"num":   1.5e21,
+		"rng":   uint8(7),
+		"color": color.RGBA{0x12, 0x34, 0xab, 0xff},
+		"text":  at,
+	}
+	htmlstr, err := FillSource([]byte(HTMLTyped), src, nil)
+	if err != nil {
+		t.Fatalf("fill typed error: %v", err)
+	}
+	if string(htmlstr) != `<form><input type="date" name="date" value="2021-01-03"><input type="month" name="month" value="2021-01"><input type="week" name="week" value="2020-W53"><input type="time" name="time" value="09:05:07"><input type="datetime-local" name="dt" value="2021-01-03T09:05:01.500"><input type="number" name="num" value="1500000000000000000000"><input type="range" name="rng" value="7"><input type="color" name="color" value="#1234ab"><input name="text" value="2021-01-03T09:05:00Z"></form>` {
+		t.Errorf("fill typed error: %v", string(htmlstr))
+	}
+
+	htmlstr, _ = FillJSON([]byte(HTMLTyped), []byte(`{"date": "2021-01-03T09:05:00+09:00", "dt": "2021-01-03T09:05:00Z", "num": 1973, "week": "2021-W01", "color": "#ABCDEF"}`), nil)
+	if string(htmlstr) != `<form><input type="date" name="date" value="2021-01-03"><input type="month" name="month" value=""><input type="week" name="week" value="2021-W01"><input type="time" name="time" value=""><input type="datetime-local" name="dt" value="2021-01-03T09:05"><input type="number" name="num" value="1973"><input type="range" name="rng" value=""><input type="color" name="color" value="#ABCDEF"><input name="text" value=""></form>` {
+		t.Errorf("fill typed json error: %v", string(htmlstr))
+	}
+
+	p := struct {
+		Birth time.Time `form:"date" layout:"02/01/2006"`
+		Text  time.Time `form:"text" layout:"02/01/2006"`
+	}{at, at}
+	htmlstr, _ = FillStruct([]byte(HTMLTyped), p, nil)
+	if string(htmlstr) != `<form><input type="date" name="date" value="2021-01-03"><input type="month" name="month" value=""><input type="week" name="week" value=""><input type="time" name="time" value=""><input type="datetime-local" name="dt" value=""><input type="number" name="num" value=""><input type="range" name="rng" value=""><input type="color" name="color" value=""><input name="text" value="03/01/2021"></form>` {
+		t.Errorf("fill typed struct error: %v", string(htmlstr))
+	}
+}
+
+func TestValidInput(t *testing.T) {
+	tests := []struct {
+		typ   string
+		value string
+		valid bool
+	}{
+		{"date", "2021-02-28", true},
+		{"date", "2021-02-30", false},
+		{"date", "tomorrow", false},
+		{"month", "2021-12", true},
+		{"month", "2021-13", false},
+		{"week", "2020-W53", true},
+		{"week", "2021-W53", false},
+		{"week", "2021-W00", false},
+		{"time", "23:59", true},
+		{"time", "23:59:59.999", true},
+		{"time", "24:00", false},
+		{"datetime-local", "2021-01-03T09:05", true},
+		{"datetime-local", "2021-01-03 09:05:01", true},
+		{"datetime-local", "2021-02-30T09:05", false},
+		{"number", "-1.5e3", true},
+		{"number", ".5", true},
+		{"number", "+1", false},
+		{"number", "NaN", false},
+		{"range", "10", true},
+		{"color", "#00ff00", true},
+		{"color", "green", false},
+	}
+	for _, test := range tests {
+		if valid := validInput(test.typ, []byte(test.value)); valid != test.valid {
+			t.Errorf("valid input error: %s %q: %v", test.typ, test.value, valid)
+		}
+	}
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	formData := map[string][]string{"date": []string{"tomorrow"}, "num": []string{"10"}}
+	src := []byte(`<form><input type="date" name="date"><input type="number" name="num"></form>`)
+
+	htmlstr, err := Fill(src, formData, nil)
+	if err != nil || string(htmlstr) != `<form><input type="date" name="date" value="tomorrow"><input type="number" name="num" value="10"></form>` {
+		t.Errorf("invalid as is error: %v, %v", string(htmlstr), err)
+	}
+	htmlstr, err = Fill(src, formData, map[string]interface{}{"Invalid": InvalidClear})
+	if err != nil || string(htmlstr) != `<form><input type="date" name="date" value=""><input type="number" name="num" value="10"></form>` {
+		t.Errorf("invalid clear error: %v, %v", string(htmlstr), err)
+	}
+
+	filler, _ := NewFiller(WithInvalid(InvalidReport))
+	htmlstr, err = filler.Fill(src, formData)
+	verr, ok := err.(*ValueError)
+	if !ok || verr.Name != "date" || verr.Type != "date" || verr.Value != "tomorrow" {
+		t.Errorf("invalid report error: %v", err)
+	}
+	if string(htmlstr) != `<form><input type="date" name="date" value=""><input type="number" name="num" value="10"></form>` {
+		t.Errorf("invalid report error: %v", string(htmlstr))
+	}
+	plan, _ := Compile(src)
+	if _, err := filler.FillPlan(plan, formData); err == nil {
+		t.Errorf("plan invalid report error expected")
+	}
+	if _, err := NewFiller(WithInvalid(InvalidPolicy(-1))); err == nil {
+		t.Errorf("unknown policy should fail")
+	}
+}
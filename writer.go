@@ -0,0 +1,317 @@
+package fillinform
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+var errWriterClosed = errors.New("fillinform: write to closed Writer")
+
+// Writer fills forms in the html written to it.
+// Bytes outside of forms are passed to the underlying writer as soon as they
+// arrive. A form is held back until its end tag has been written, so forms
+// split across several Write calls are still filled. A control whose form
+// attribute names a form not written yet is held back, with all after it,
+// until that form is written. It is let go without a form at </body> or
+// </html>, or when too much has been held back for it.
+// Call Close after the last Write to emit what is left.
+// A Writer may be used from several goroutines.
+//
+// Write fails only when the underlying writer fails, the options are invalid
+// or a held back form grows beyond MaxSize. Malformed html is passed through
+// and the first *ParseError, or else *ValueError, is returned by Close. An
+// error from a FieldHook that stopped the fill comes before both.
+type Writer struct {
+	mu       sync.Mutex
+	filler   *fillState
+	wr       io.Writer
+	buf      []byte
+	err      error
+	parseErr *ParseError
+
+	// position of buf[0] in the whole output
+	off, line, col int
+
+	held    heldElement
+	pending pendingForm
+}
+
+// heldElement is an element in Writer.buf whose end tag has not been
+// written yet.
+type heldElement struct {
+	name  string // "" when there is none
+	raw   bool   // raw text, ended by the first </name>
+	start int
+	next  int // where to look for the end tag from
+	depth int // nested templates open at next
+}
+
+// pendingForm is the form a control held back in Writer.buf is waiting for.
+type pendingForm struct {
+	id      string // "" when there is none
+	start   int    // where buf is held back from
+	scanned int    // buf is complete html up to here
+}
+
+// return writer implement interface io.Writer.
+// An error in options is returned by the first call to Write or Close.
+func FillWriter(wr io.Writer, data map[string][]string, options map[string]interface{}) *Writer {
+	filler, err := newFiller(data, options)
+	return &Writer{filler: filler, wr: wr, err: err}
+}
+
+// Writer returns a Writer that fills the html written to it with data
+// and writes the result to wr.
+func (f *Filler) Writer(wr io.Writer, data map[string][]string) *Writer {
+	return &Writer{filler: f.newState(data), wr: wr}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	if err := w.emit(); err != nil {
+		w.err = err
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush flushes the underlying writer when it supports flushing.
+// Bytes of an unfinished form stay buffered.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+func (w *Writer) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	switch fw := w.wr.(type) {
+	case interface {
+		Flush() error
+	}:
+		return fw.Flush()
+	case interface {
+		Flush()
+	}:
+		fw.Flush()
+	}
+	return nil
+}
+
+// Close fills and writes out the buffered tail and flushes the underlying
+// writer. A form without an end tag is written as is and reported as a
+// *ParseError.
+// Close does not close the underlying writer.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buf) > 0 {
+		// filled as Fill would, e.g. an unterminated template
+		p, err := compile(w.buf)
+		if err != nil {
+			w.setParseError(err)
+		}
+		if _, err := w.wr.Write(w.filler.fillPlan(p)); err != nil {
+			w.err = err
+			return err
+		}
+		w.buf = nil
+	}
+	err := w.flush()
+	w.err = errWriterClosed
+	if err == nil && w.parseErr != nil && !w.filler.aborted {
+		return w.parseErr
+	}
+	if err == nil && w.filler.err != nil {
+		return w.filler.err
+	}
+	return err
+}
+
+// emit writes out everything in buf that can no longer become part of a form
+// and keeps the rest for the next Write.
+func (w *Writer) emit() error {
+	// cut is the end of the part of buf that can no longer become part of a
+	// form, only the bytes written since the last call are scanned
+	cut, i := len(w.buf), w.pending.scanned
+	scan := true
+	if h := &w.held; h.name != "" {
+		var end int
+		if h.raw {
+			_, end, h.next = scanEndTag(w.buf, h.next, h.name)
+		} else {
+			_, end, h.next, h.depth = scanElement(w.buf, h.next, h.name, h.depth)
+		}
+		if end < 0 {
+			cut, scan = h.start, false
+		} else {
+			i, h.name = end, ""
+		}
+	}
+	for scan {
+		start, end, complete := findForm(w.buf, i)
+		if start < 0 {
+			break
+		}
+		if !complete {
+			cut = start
+			w.hold(start)
+			break
+		}
+		i = end
+	}
+
+	// controls before release are not held back for their form any more
+	release := 0
+	if pd := &w.pending; pd.id != "" {
+		found := false
+		if pd.scanned < cut {
+			var closed bool
+			found, closed = findFormID(w.buf[pd.scanned:cut], pd.id)
+			if closed {
+				release = cut
+			}
+			pd.scanned = cut
+		}
+		if n := len(w.buf) - pd.start; n > maxHoldBack || w.filler.checkSize(n) != nil {
+			release = cut
+		}
+		if !found && release == 0 {
+			return w.filler.checkSize(len(w.buf) - cut)
+		}
+		w.pending = pendingForm{}
+	}
+	if err := w.filler.checkSize(len(w.buf) - cut); err != nil {
+		return err
+	}
+	if cut == 0 {
+		return nil
+	}
+
+	p, err := compile(w.buf[:cut])
+	if hold, id := w.holdFrom(p, release); hold >= 0 {
+		w.pending = pendingForm{id: id, start: hold, scanned: cut}
+		cut = hold
+		p = p.prefix(cut)
+	}
+	if perr, ok := err.(*ParseError); ok && perr.Offset < cut {
+		w.setParseError(err)
+	}
+	if _, err := w.wr.Write(w.filler.fillPlan(p)); err != nil {
+		return err
+	}
+	w.advance(w.buf[:cut])
+	w.buf = append(w.buf[:0], w.buf[cut:]...)
+	w.held.start -= cut
+	w.held.next -= cut
+	if w.pending.id != "" {
+		w.pending.start -= cut
+		w.pending.scanned -= cut
+	}
+	return nil
+}
+
+// maxHoldBack limits the bytes held back for a control whose form has not
+// been written yet. The control then gets no form, as for a form attribute
+// naming no form at all.
+const maxHoldBack = 64 << 10
+
+// findFormID reports whether b, complete html, has the form of the given id,
+// and whether it ends the body or html element, after which no more forms
+// are expected.
+func findFormID(b []byte, id string) (found, closed bool) {
+	p, _ := compile(b)
+	for i := range p.forms {
+		if form := &p.forms[i]; !form.inTemplate {
+			if fid, _ := form.tag.get(_Id); string(decodeEntity(fid)) == id {
+				found = true
+			}
+		}
+	}
+	lower := bytes.ToLower(b)
+	closed = bytes.Contains(lower, []byte(`</body`)) || bytes.Contains(lower, []byte(`</html`))
+	return found, closed
+}
+
+// hold remembers the element held back at w.buf[i], so that its end is
+// looked for in the bytes written next only.
+func (w *Writer) hold(i int) {
+	t, state := parseTag(w.buf, i, false)
+	if state != tagOK || t.closing {
+		return
+	}
+	switch raw := rawText(&t); {
+	case raw != "":
+		w.held = heldElement{name: raw, raw: true, start: i, next: t.end}
+	case t.is(_Form), t.is(_Template), t.is(_Select):
+		w.held = heldElement{name: string(bytes.ToLower(t.name)), start: i, next: t.end}
+	}
+}
+
+// holdFrom returns where to hold back p from for its first control at or
+// after p.src[from] whose form attribute names a form not written yet, so the
+// control is filled with that form once it arrives, and the id of the form.
+// It is -1 when there is no such control.
+func (w *Writer) holdFrom(p *Plan, from int) (int, string) {
+	ids := make(map[string]bool, len(p.forms))
+	for i := range p.forms {
+		if id, _ := p.forms[i].tag.get(_Id); len(id) > 0 && !p.forms[i].inTemplate {
+			ids[string(decodeEntity(id))] = true
+		}
+	}
+	for i := range p.controls {
+		c := &p.controls[i]
+		if !c.hasFormAttr || c.inTemplate || c.tag.start < from {
+			continue
+		}
+		id := string(decodeEntity(c.formAttr))
+		if id == "" || ids[id] || w.filler.formsByID[id] != nil {
+			continue
+		}
+		if c.form >= 0 {
+			// keep the form it is in whole
+			return p.forms[c.form].tag.start, id
+		}
+		return c.tag.start, id
+	}
+	return -1, ""
+}
+
+// setParseError keeps the first parse error, moved to its position in the
+// whole output.
+func (w *Writer) setParseError(err error) {
+	perr, ok := err.(*ParseError)
+	if !ok || w.parseErr != nil {
+		return
+	}
+	e := *perr
+	e.Offset += w.off
+	if e.Line == 1 {
+		e.Column += w.col
+	}
+	e.Line += w.line
+	w.parseErr = &e
+}
+
+// advance moves the position of buf[0] past b.
+func (w *Writer) advance(b []byte) {
+	w.off += len(b)
+	if n := bytes.Count(b, []byte{'\n'}); n > 0 {
+		w.line += n
+		w.col = len(b) - bytes.LastIndexByte(b, '\n') - 1
+	} else {
+		w.col += len(b)
+	}
+}
@@ -0,0 +1,200 @@
+package fillinform
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var writerFormData = map[string][]string{
+	"sex":              []string{"1"},
+	"user_name":        []string{"かわたん"},
+	"loginid":          []string{"kawatan"},
+	"user_birth":       []string{"1973"},
+	"user_birth_month": []string{"02"},
+	"user_birth_day":   []string{"17"},
+	"user_tdfk":        []string{"P14"},
+	"job_code":         []string{"12"},
+	"ctg_no":           []string{"C11"},
+	".site_token":      []string{"t0.tSEbWYjOBNbOEfuBNV_Zqa6JVg4"},
+}
+
+func TestWriterSplit(t *testing.T) {
+	src := []byte(HTMLBig)
+	for _, size := range []int{1, 3, 7, 64, 1000} {
+		var buf bytes.Buffer
+		w := FillWriter(&buf, writerFormData, nil)
+		for i := 0; i < len(src); i += size {
+			end := i + size
+			if end > len(src) {
+				end = len(src)
+			}
+			if _, err := w.Write(src[i:end]); err != nil {
+				t.Fatalf("write error: %v", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("close error: %v", err)
+		}
+		if buf.String() != HTMLBigSuccess {
+			t.Errorf("split writer error (chunk %d): %s", size, buf.String())
+		}
+	}
+}
+
+func TestWriterPassThrough(t *testing.T) {
+	var buf bytes.Buffer
+	w := FillWriter(&buf, writerFormData, nil)
+
+	w.Write([]byte(`<html><body><p>hello</p><for`))
+	if buf.String() != `<html><body><p>hello</p>` {
+		t.Errorf("pass through error: %v", buf.String())
+	}
+	w.Write([]byte(`m id="f"><input type="text" name="user_name">`))
+	if buf.String() != `<html><body><p>hello</p>` {
+		t.Errorf("hold back error: %v", buf.String())
+	}
+	w.Write([]byte(`</form><formula>`))
+	if buf.String() != `<html><body><p>hello</p><form id="f"><input type="text" name="user_name" value="かわたん"></form><formula>` {
+		t.Errorf("fill error: %v", buf.String())
+	}
+	w.Write([]byte(`<form id="g"><input type="text" name="loginid">`))
+	w.Close()
+	if buf.String() != `<html><body><p>hello</p><form id="f"><input type="text" name="user_name" value="かわたん"></form><formula><form id="g"><input type="text" name="loginid">` {
+		t.Errorf("close error: %v", buf.String())
+	}
+	if _, err := w.Write([]byte(`x`)); err == nil {
+		t.Errorf("write after close should fail")
+	}
+}
+
+func TestWriterFormAttribute(t *testing.T) {
+	var buf bytes.Buffer
+	w := FillWriter(&buf, writerFormData, map[string]interface{}{"Target": "f", "FillOutside": true})
+	w.Write([]byte(`<form id="f"></form><form id="g"></form><p><inp`))
+	w.Write([]byte(`ut name="loginid" form="f"><input name="user_name" form="g"><select name="job_code"><option>1`))
+	w.Write([]byte(`2</option></select><input name="loginid">`))
+	w.Close()
+	if buf.String() != `<form id="f"></form><form id="g"></form><p><input name="loginid" form="f" value="kawatan"><input name="user_name" form="g"><select name="job_code"><option selected="selected">12</option></select><input name="loginid" value="kawatan">` {
+		t.Errorf("form attribute writer error: %s", buf.String())
+	}
+}
+
+func TestWriterFormForwardReference(t *testing.T) {
+	var buf bytes.Buffer
+	w := FillWriter(&buf, writerFormData, nil)
+	w.Write([]byte(`<p>top</p><header><input form="search" name="loginid"></header>`))
+	if buf.String() != `<p>top</p><header>` {
+		t.Errorf("hold back forward reference error: %s", buf.String())
+	}
+	w.Write([]byte(`<main><form id="search"></form></main><input form="none" name="loginid">`))
+	if buf.String() != `<p>top</p><header><input form="search" name="loginid" value="kawatan"></header><main><form id="search"></form></main>` {
+		t.Errorf("forward reference error: %s", buf.String())
+	}
+	w.Write([]byte(`<p>end</p>`))
+	w.Close()
+	if buf.String() != `<p>top</p><header><input form="search" name="loginid" value="kawatan"></header><main><form id="search"></form></main><input form="none" name="loginid"><p>end</p>` {
+		t.Errorf("unresolved reference error: %s", buf.String())
+	}
+	// a form that never comes is not waited for past </body>
+	buf.Reset()
+	w = FillWriter(&buf, writerFormData, nil)
+	w.Write([]byte(`<body><input form="gone" name="loginid"><p>x</p>`))
+	w.Write([]byte(`</body></html>`))
+	if buf.String() != `<body><input form="gone" name="loginid"><p>x</p></body></html>` {
+		t.Errorf("release at body end error: %s", buf.String())
+	}
+
+	// nor past MaxSize, which does not fail the write
+	buf.Reset()
+	w = FillWriter(&buf, writerFormData, map[string]interface{}{"MaxSize": 100})
+	if _, err := w.Write([]byte(`<input form="gone" name="loginid">`)); err != nil {
+		t.Errorf("write error: %v", err)
+	}
+	for i := 0; i < 30; i++ {
+		if _, err := w.Write([]byte(`<p>held</p>`)); err != nil {
+			t.Fatalf("dangling form reference write error: %v", err)
+		}
+	}
+	if !strings.HasPrefix(buf.String(), `<input form="gone" name="loginid"><p>held</p>`) || buf.Len() < 200 {
+		t.Errorf("release at MaxSize error: %s", buf.String())
+	}
+
+	// nor past maxHoldBack without MaxSize
+	buf.Reset()
+	w = FillWriter(&buf, writerFormData, nil)
+	w.Write([]byte(`<input form="gone" name="loginid">`))
+	w.Write(bytes.Repeat([]byte(`<p>held</p>`), maxHoldBack/10))
+	if buf.Len() < maxHoldBack {
+		t.Errorf("release at maxHoldBack error: %d bytes written", buf.Len())
+	}
+}
+
+func BenchmarkWriter(b *testing.B) {
+	src := []byte(HTMLBig)
+	var buf bytes.Buffer
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		w := FillWriter(&buf, writerFormData, nil)
+		w.Write(src[:len(src)/2])
+		w.Write(src[len(src)/2:])
+		w.Close()
+	}
+}
+
+// BenchmarkWriterSmallChunks writes in the small chunks html/template
+// flushes, a held back form must not be scanned again for each of them.
+func BenchmarkWriterSmallChunks(b *testing.B) {
+	src := []byte(HTMLBig)
+	var buf bytes.Buffer
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		w := FillWriter(&buf, writerFormData, nil)
+		for j := 0; j < len(src); j += 16 {
+			end := j + 16
+			if end > len(src) {
+				end = len(src)
+			}
+			w.Write(src[j:end])
+		}
+		w.Close()
+	}
+}
+
+func TestWriterConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	filler, _ := NewFiller()
+	w := filler.Writer(&buf, writerFormData)
+
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			w.Write([]byte(`<p>x</p>`))
+			done <- true
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	w.Close()
+	if buf.String() != `<p>x</p><p>x</p><p>x</p><p>x</p>` {
+		t.Errorf("concurrent writer error: %s", buf.String())
+	}
+}
+
+func TestWriterCloseFills(t *testing.T) {
+	src := `<p></p><template><form><input name="loginid"></form>`
+	want, _ := Fill([]byte(src), writerFormData, map[string]interface{}{"FillTemplates": true})
+
+	var buf bytes.Buffer
+	w := FillWriter(&buf, writerFormData, map[string]interface{}{"FillTemplates": true})
+	w.Write([]byte(src))
+	if err := w.Close(); err != nil {
+		t.Errorf("close error: %v", err)
+	}
+	if buf.String() != string(want) || buf.String() != `<p></p><template><form><input name="loginid" value="kawatan"></form>` {
+		t.Errorf("close fill error: %s", buf.String())
+	}
+}